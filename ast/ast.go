@@ -10,6 +10,8 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	// Span is the stretch of source the node was parsed from.
+	Span() token.Span
 }
 
 type Statement interface {
@@ -24,6 +26,8 @@ type Expression interface {
 
 type Program struct {
 	Statements []Statement
+	// Comments holds the comments stripped out by the lexer, in source order.
+	Comments []token.Token
 }
 
 func (p *Program) String() string {
@@ -36,6 +40,14 @@ func (p *Program) String() string {
 	return out.String()
 }
 
+func (p *Program) Span() token.Span {
+	if len(p.Statements) == 0 {
+		return token.Span{}
+	}
+	first := p.Statements[0].Span()
+	return first.To(p.Statements[len(p.Statements)-1].Span())
+}
+
 func (p *Program) TokenLiteral() string {
 	if len(p.Statements) > 0 {
 		return p.Statements[0].TokenLiteral()
@@ -66,6 +78,12 @@ func (as *AskStatement) String() string {
 }
 func (as *AskStatement) statementNode()       {}
 func (as *AskStatement) TokenLiteral() string { return as.Token.Literal }
+func (as *AskStatement) Span() token.Span {
+	if as.Value != nil {
+		return as.Token.Span.To(as.Value.Span())
+	}
+	return as.Token.Span.To(as.Name.Span())
+}
 
 type ReturnStatement struct {
 	Token       token.Token
@@ -87,6 +105,12 @@ func (rs *ReturnStatement) String() string {
 }
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Span() token.Span {
+	if rs.ReturnValue != nil {
+		return rs.Token.Span.To(rs.ReturnValue.Span())
+	}
+	return rs.Token.Span
+}
 
 type Identifier struct {
 	Token token.Token
@@ -96,6 +120,7 @@ type Identifier struct {
 func (i *Identifier) String() string       { return i.Value }
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Span() token.Span     { return i.Token.Span }
 
 type ExpressionStatement struct {
 	Token      token.Token
@@ -110,6 +135,12 @@ func (es *ExpressionStatement) String() string {
 }
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Span() token.Span {
+	if es.Expression != nil {
+		return es.Token.Span.To(es.Expression.Span())
+	}
+	return es.Token.Span
+}
 
 type IntegerLiteral struct {
 	Token token.Token
@@ -119,6 +150,17 @@ type IntegerLiteral struct {
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
+func (il *IntegerLiteral) Span() token.Span     { return il.Token.Span }
+
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+func (fl *FloatLiteral) Span() token.Span     { return fl.Token.Span }
 
 type PrefixExpression struct {
 	Token    token.Token
@@ -128,6 +170,12 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Span() token.Span {
+	if pe.Right != nil {
+		return pe.Token.Span.To(pe.Right.Span())
+	}
+	return pe.Token.Span
+}
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -139,6 +187,38 @@ func (pe *PrefixExpression) String() string {
 	return out.String()
 }
 
+// AssignExpression updates an existing binding or element, as in `x = 5`,
+// `xs[0] = 5` or the compound `x += 1`.
+type AssignExpression struct {
+	Token    token.Token // the = or compound assignment token
+	Target   Expression
+	Operator string
+	Value    Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) Span() token.Span {
+	span := ae.Target.Span().To(ae.Token.Span)
+	if ae.Value != nil {
+		span = span.To(ae.Value.Span())
+	}
+	return span
+}
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" " + ae.Operator + " ")
+	if ae.Value != nil {
+		out.WriteString(ae.Value.String())
+	}
+	out.WriteString(")")
+
+	return out.String()
+}
+
 type InfixExpression struct {
 	Token    token.Token
 	Left     Expression
@@ -148,6 +228,16 @@ type InfixExpression struct {
 
 func (ie *InfixExpression) expressionNode()      {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) Span() token.Span {
+	span := ie.Token.Span
+	if ie.Left != nil {
+		span = ie.Left.Span().To(span)
+	}
+	if ie.Right != nil {
+		span = span.To(ie.Right.Span())
+	}
+	return span
+}
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -169,7 +259,8 @@ func (b *Boolean) expressionNode() {}
 func (b *Boolean) TokenLiteral() string {
 	return b.Token.Literal
 }
-func (b *Boolean) String() string { return b.Token.Literal }
+func (b *Boolean) String() string   { return b.Token.Literal }
+func (b *Boolean) Span() token.Span { return b.Token.Span }
 
 type IfExpression struct {
 	Token       token.Token
@@ -180,22 +271,283 @@ type IfExpression struct {
 
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Span() token.Span {
+	if ie.Alternative != nil {
+		return ie.Token.Span.To(ie.Alternative.Span())
+	}
+	if ie.Consequence != nil {
+		return ie.Token.Span.To(ie.Consequence.Span())
+	}
+	return ie.Token.Span
+}
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
-	out.WriteString("if")
-	out.WriteString(ie.Condition.String())
+	out.WriteString("consider ")
+	out.WriteString(parenthesize(ie.Condition))
 	out.WriteString(" ")
-	out.WriteString(ie.Consequence.String())
+	out.WriteString(braced(ie.Consequence))
 
 	if ie.Alternative != nil {
-		out.WriteString("else ")
-		out.WriteString(ie.Alternative.String())
+		out.WriteString(" however ")
+		if elseIf, ok := ie.ElseIf(); ok {
+			out.WriteString(elseIf.String())
+		} else {
+			out.WriteString(braced(ie.Alternative))
+		}
+	}
+
+	return out.String()
+}
+
+// ElseIf returns the nested IfExpression of a `however consider` chain. The
+// parser wraps it in an Alternative block of its own, starting at the
+// consider token, so evaluation needs no special casing.
+func (ie *IfExpression) ElseIf() (*IfExpression, bool) {
+	if ie.Alternative == nil || ie.Alternative.Token.Type != token.IF ||
+		len(ie.Alternative.Statements) != 1 {
+		return nil, false
+	}
+	stmt, ok := ie.Alternative.Statements[0].(*ExpressionStatement)
+	if !ok {
+		return nil, false
+	}
+	elseIf, ok := stmt.Expression.(*IfExpression)
+	return elseIf, ok
+}
+
+// parenthesize wraps exp in parens, unless its String already does.
+func parenthesize(exp Expression) string {
+	switch exp.(type) {
+	case *InfixExpression, *PrefixExpression, *AssignExpression, *IndexExpression:
+		return exp.String()
+	default:
+		return "(" + exp.String() + ")"
+	}
+}
+
+// braced renders a block with its squiggles, for the nodes whose String
+// should read like source.
+func braced(block *BlockStatement) string {
+	if len(block.Statements) == 0 {
+		return "{}"
+	}
+
+	stmts := []string{}
+	for _, s := range block.Statements {
+		stmts = append(stmts, s.String())
+	}
+
+	return "{ " + strings.Join(stmts, " ") + " }"
+}
+
+// MatchExpression evaluates the Body of the first arm whose pattern matches
+// Subject, as in
+//
+//	sniff (x) { 0 => "none", [first, ...rest] => first, _ => x }
+type MatchExpression struct {
+	Token   token.Token // the sniff token
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+// MatchArm is one `pattern consider (guard) => body` arm of a sniff. Patterns
+// are expressions limited to literals, names that bind the value (with _
+// binding nothing), and array and hash literals of patterns. An array
+// pattern may end in ...rest to collect the remaining elements. Guard is nil
+// when the arm has none. A body that isn't a block gets wrapped in one.
+type MatchArm struct {
+	Pattern Expression
+	Guard   Expression
+	Body    *BlockStatement
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) Span() token.Span {
+	if len(me.Arms) > 0 && me.Arms[len(me.Arms)-1].Body != nil {
+		return me.Token.Span.To(me.Arms[len(me.Arms)-1].Body.Span())
+	}
+	return me.Token.Span
+}
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+
+	out.WriteString(me.TokenLiteral() + " ")
+	out.WriteString(parenthesize(me.Subject))
+	out.WriteString(" { ")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ma.Pattern.String())
+	if ma.Guard != nil {
+		out.WriteString(" consider ")
+		out.WriteString(parenthesize(ma.Guard))
 	}
+	out.WriteString(" => ")
+	if ma.Body.Token.Type == token.LSQUIGGLE {
+		out.WriteString(braced(ma.Body))
+	} else {
+		out.WriteString(ma.Body.String())
+	}
+
+	return out.String()
+}
+
+// TryExpression evaluates Body and, if that produces an error, evaluates
+// Handler instead with the error bound to Param, as in
+// `attempt { risky() } fetch (e) { e["message"] }`. Param is nil when the
+// fetch doesn't name the error.
+type TryExpression struct {
+	Token   token.Token // the attempt token
+	Body    *BlockStatement
+	Param   *Identifier
+	Handler *BlockStatement
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) Span() token.Span {
+	if te.Handler != nil {
+		return te.Token.Span.To(te.Handler.Span())
+	}
+	return te.Token.Span
+}
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(te.TokenLiteral() + " ")
+	out.WriteString(braced(te.Body))
+	out.WriteString(" fetch ")
+	if te.Param != nil {
+		out.WriteString("(" + te.Param.String() + ") ")
+	}
+	out.WriteString(braced(te.Handler))
+
+	return out.String()
+}
+
+// ThrowStatement raises an error from Value, as in `yeet "out of cheese"`.
+type ThrowStatement struct {
+	Token token.Token // the yeet token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) Span() token.Span {
+	if ts.Value != nil {
+		return ts.Token.Span.To(ts.Value.Span())
+	}
+	return ts.Token.Span
+}
+func (ts *ThrowStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ts.TokenLiteral() + " ")
+	if ts.Value != nil {
+		out.WriteString(ts.Value.String())
+	}
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// WhileStatement runs Body for as long as Condition is truthy.
+type WhileStatement struct {
+	Token     token.Token // the whilst token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) Span() token.Span {
+	if ws.Body != nil {
+		return ws.Token.Span.To(ws.Body.Span())
+	}
+	return ws.Token.Span
+}
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ws.TokenLiteral() + " ")
+	out.WriteString(parenthesize(ws.Condition))
+	out.WriteString(" ")
+	out.WriteString(braced(ws.Body))
 
 	return out.String()
 }
 
+// ForInStatement runs Body once for each item in Iterable, as in
+// `peruse (x in xs)` or `peruse (k, v in h)`. With a single name, arrays,
+// strings and ranges bind each element to Value while hashes bind each key.
+// With two names, Key gets the index or hash key and Value the element or
+// hash value.
+type ForInStatement struct {
+	Token    token.Token // the peruse token
+	Key      *Identifier
+	Value    *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForInStatement) statementNode()       {}
+func (fs *ForInStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForInStatement) Span() token.Span {
+	if fs.Body != nil {
+		return fs.Token.Span.To(fs.Body.Span())
+	}
+	return fs.Token.Span
+}
+func (fs *ForInStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(fs.TokenLiteral())
+	out.WriteString(" (")
+	if fs.Key != nil {
+		out.WriteString(fs.Key.String() + ", ")
+	}
+	out.WriteString(fs.Value.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(braced(fs.Body))
+
+	return out.String()
+}
+
+// BreakStatement leaves the innermost loop.
+type BreakStatement struct {
+	Token token.Token // the enough token
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) String() string       { return bs.Token.Literal + ";" }
+func (bs *BreakStatement) Span() token.Span     { return bs.Token.Span }
+
+// ContinueStatement skips to the next iteration of the innermost loop.
+type ContinueStatement struct {
+	Token token.Token // the anyway token
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) String() string       { return cs.Token.Literal + ";" }
+func (cs *ContinueStatement) Span() token.Span     { return cs.Token.Span }
+
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
@@ -203,6 +555,12 @@ type BlockStatement struct {
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Span() token.Span {
+	if len(bs.Statements) > 0 {
+		return bs.Token.Span.To(bs.Statements[len(bs.Statements)-1].Span())
+	}
+	return bs.Token.Span
+}
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -216,18 +574,38 @@ func (bs *BlockStatement) String() string {
 type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
-	Body       *BlockStatement
+	// Defaults holds the default value expressions of optional parameters,
+	// keyed by parameter name.
+	Defaults map[string]Expression
+	// Rest collects any arguments past Parameters, as in funk(a, ...rest).
+	Rest *Identifier
+	Body *BlockStatement
+	// Name is the name the function was bound to with ask, if any.
+	Name string
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Span() token.Span {
+	if fl.Body != nil {
+		return fl.Token.Span.To(fl.Body.Span())
+	}
+	return fl.Token.Span
+}
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
 	params := []string{}
 	for _, p := range fl.Parameters {
+		if def, ok := fl.Defaults[p.Value]; ok {
+			params = append(params, p.String()+" = "+def.String())
+			continue
+		}
 		params = append(params, p.String())
 	}
+	if fl.Rest != nil {
+		params = append(params, "..."+fl.Rest.String())
+	}
 
 	out.WriteString(fl.TokenLiteral())
 	out.WriteString("(")
@@ -242,10 +620,18 @@ type CallExpression struct {
 	Token     token.Token
 	Function  Expression
 	Arguments []Expression
+	Close     token.Token // the closing ) token
 }
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Span() token.Span {
+	span := ce.Function.Span().To(ce.Token.Span)
+	if len(ce.Arguments) > 0 && ce.Arguments[len(ce.Arguments)-1] != nil {
+		span = span.To(ce.Arguments[len(ce.Arguments)-1].Span())
+	}
+	return span.To(ce.Close.Span)
+}
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -270,14 +656,23 @@ type StringLiteral struct {
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
+func (sl *StringLiteral) Span() token.Span     { return sl.Token.Span }
 
 type ArrayLiteral struct {
 	Token    token.Token
 	Elements []Expression
+	Close    token.Token // the closing ] token
 }
 
 func (al *ArrayLiteral) expressionNode()      {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Span() token.Span {
+	span := al.Token.Span
+	if len(al.Elements) > 0 && al.Elements[len(al.Elements)-1] != nil {
+		span = span.To(al.Elements[len(al.Elements)-1].Span())
+	}
+	return span.To(al.Close.Span)
+}
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 
@@ -293,14 +688,44 @@ func (al *ArrayLiteral) String() string {
 	return out.String()
 }
 
+// SpreadExpression expands an array into the surrounding call arguments or
+// array elements, as in add(...pair) or [0, ...rest].
+type SpreadExpression struct {
+	Token token.Token // the ... token
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode()      {}
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadExpression) String() string {
+	if se.Value == nil {
+		return se.Token.Literal
+	}
+	return se.Token.Literal + se.Value.String()
+}
+func (se *SpreadExpression) Span() token.Span {
+	if se.Value != nil {
+		return se.Token.Span.To(se.Value.Span())
+	}
+	return se.Token.Span
+}
+
 type IndexExpression struct {
 	Token token.Token
 	Left  Expression
 	Index Expression
+	Close token.Token // the closing ] token
 }
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Span() token.Span {
+	span := ie.Left.Span().To(ie.Token.Span)
+	if ie.Index != nil {
+		span = span.To(ie.Index.Span())
+	}
+	return span.To(ie.Close.Span)
+}
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 
@@ -316,10 +741,20 @@ func (ie *IndexExpression) String() string {
 type HashLiteral struct {
 	Token token.Token
 	Pairs map[Expression]Expression
+	Close token.Token // the closing } token
 }
 
 func (hl *HashLiteral) expressionNode()      {}
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Span() token.Span {
+	span := hl.Token.Span
+	for _, value := range hl.Pairs {
+		if value != nil && value.Span().End.Offset > span.End.Offset {
+			span = span.To(value.Span())
+		}
+	}
+	return span.To(hl.Close.Span)
+}
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
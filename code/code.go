@@ -0,0 +1,322 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/Linkinlog/MagLang/token"
+)
+
+type Instructions []byte
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",
+			len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+	OpDup
+	OpSwap
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpEqual
+	OpNotEqual
+	OpLessThan
+	OpGreaterThan
+	OpLessEqual
+	OpGreaterEqual
+	OpMinus
+	OpBang
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpJump
+	OpJumpNotTruthy
+	// OpJumpIfArg jumps when the call passed an argument for the parameter
+	// in the given local slot, skipping the code for its default.
+	OpJumpIfArg
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetBuiltin
+	// Locals that a closure captures live in a cell, so the closure and the
+	// funk it came from see each other's assignments.
+	OpGetCell
+	OpSetCell
+	OpFreshCell
+	OpGetFree
+	OpSetFree
+	// OpLoadCell and OpLoadFreeCell push the cell itself rather than what
+	// it holds, for handing to a new closure.
+	OpLoadCell
+	OpLoadFreeCell
+
+	OpArray
+	OpHash
+	OpIndex
+	// OpSetIndex stores into an array or hash. OpSetIndexOp does the same
+	// for a compound assignment, applying the arithmetic opcode given as
+	// its operand first.
+	OpSetIndex
+	OpSetIndexOp
+	OpSpread
+	OpConcat
+
+	OpClosure
+	OpCall
+	OpCallSpread
+	OpReturnValue
+
+	OpIter
+	OpIterNext
+	// OpMarkStack saves the stack depth in a local slot as a loop starts,
+	// and OpUnwindStack drops back to it when enough or anyway jumps out
+	// from the middle of an expression.
+	OpMarkStack
+	OpUnwindStack
+
+	OpMatchArray
+	OpMatchHash
+	OpHasKey
+	OpRest
+	OpMatchEqual
+	OpNoMatch
+
+	OpTry
+	OpEndTry
+	OpThrow
+	// OpRaise fails with the string constant as the error message, for
+	// mistakes like unknown identifiers that the evaluator only reports if
+	// the code actually runs.
+	OpRaise
+)
+
+// Definition describes an opcode's operands. Constant indexes and jump
+// targets grow with the size of the program, so they get 4 bytes; the
+// rest count things that are small in any sensible program.
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{4}},
+	OpPop:      {"OpPop", []int{}},
+	OpDup:      {"OpDup", []int{}},
+	OpSwap:     {"OpSwap", []int{}},
+
+	OpAdd:          {"OpAdd", []int{}},
+	OpSub:          {"OpSub", []int{}},
+	OpMul:          {"OpMul", []int{}},
+	OpDiv:          {"OpDiv", []int{}},
+	OpMod:          {"OpMod", []int{}},
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpLessThan:     {"OpLessThan", []int{}},
+	OpGreaterThan:  {"OpGreaterThan", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpMinus:        {"OpMinus", []int{}},
+	OpBang:         {"OpBang", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpJump:          {"OpJump", []int{4}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{4}},
+	OpJumpIfArg:     {"OpJumpIfArg", []int{1, 4}},
+
+	OpGetGlobal:    {"OpGetGlobal", []int{2}},
+	OpSetGlobal:    {"OpSetGlobal", []int{2}},
+	OpGetLocal:     {"OpGetLocal", []int{1}},
+	OpSetLocal:     {"OpSetLocal", []int{1}},
+	OpGetBuiltin:   {"OpGetBuiltin", []int{1}},
+	OpGetCell:      {"OpGetCell", []int{1}},
+	OpSetCell:      {"OpSetCell", []int{1}},
+	OpFreshCell:    {"OpFreshCell", []int{1}},
+	OpGetFree:      {"OpGetFree", []int{1}},
+	OpSetFree:      {"OpSetFree", []int{1}},
+	OpLoadCell:     {"OpLoadCell", []int{1}},
+	OpLoadFreeCell: {"OpLoadFreeCell", []int{1}},
+
+	OpArray:      {"OpArray", []int{2}},
+	OpHash:       {"OpHash", []int{2}},
+	OpIndex:      {"OpIndex", []int{}},
+	OpSetIndex:   {"OpSetIndex", []int{}},
+	OpSetIndexOp: {"OpSetIndexOp", []int{1}},
+	OpSpread:     {"OpSpread", []int{}},
+	OpConcat:     {"OpConcat", []int{2}},
+
+	OpClosure:     {"OpClosure", []int{4, 1}},
+	OpCall:        {"OpCall", []int{1}},
+	OpCallSpread:  {"OpCallSpread", []int{}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+
+	OpIter:     {"OpIter", []int{1}},
+	OpIterNext: {"OpIterNext", []int{4}},
+
+	OpMarkStack:   {"OpMarkStack", []int{1}},
+	OpUnwindStack: {"OpUnwindStack", []int{1}},
+
+	OpMatchArray: {"OpMatchArray", []int{2, 1}},
+	OpMatchHash:  {"OpMatchHash", []int{}},
+	OpHasKey:     {"OpHasKey", []int{}},
+	OpRest:       {"OpRest", []int{2}},
+	OpMatchEqual: {"OpMatchEqual", []int{}},
+	OpNoMatch:    {"OpNoMatch", []int{}},
+
+	OpTry:    {"OpTry", []int{4}},
+	OpEndTry: {"OpEndTry", []int{}},
+	OpThrow:  {"OpThrow", []int{}},
+	OpRaise:  {"OpRaise", []int{4}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// Make encodes op and its operands as an instruction.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 4:
+			binary.BigEndian.PutUint32(instruction[offset:], uint32(o))
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands following an instruction's opcode,
+// returning them along with how many bytes they took up.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 4:
+			operands[i] = int(ReadUint32(ins[offset:]))
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+// Fits reports whether operand can be encoded in width bytes.
+func Fits(operand, width int) bool {
+	return operand >= 0 && operand < 1<<(8*width)
+}
+
+func ReadUint32(ins Instructions) uint32 {
+	return binary.BigEndian.Uint32(ins)
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 { return uint8(ins[0]) }
+
+// Position ties the instructions from Offset onwards to the source they
+// were compiled from.
+type Position struct {
+	Offset int
+	Span   token.Span
+}
+
+// SourceMap is a list of Positions in order of their offsets.
+type SourceMap []Position
+
+// SpanAt returns the span of the source the instruction at offset was
+// compiled from.
+func (sm SourceMap) SpanAt(offset int) token.Span {
+	i := sort.Search(len(sm), func(i int) bool { return sm[i].Offset > offset })
+	if i == 0 {
+		return token.Span{}
+	}
+	return sm[i-1].Span
+}
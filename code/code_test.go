@@ -0,0 +1,156 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/Linkinlog/MagLang/token"
+)
+
+func TestMake(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 0, 0, 255, 254}},
+		{OpConstant, []int{1 << 24}, []byte{byte(OpConstant), 1, 0, 0, 0}},
+		{OpArray, []int{65534}, []byte{byte(OpArray), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 0, 0, 255, 254, 255}},
+		{OpJumpIfArg, []int{1, 513}, []byte{byte(OpJumpIfArg), 1, 0, 0, 2, 1}},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		if len(instruction) != len(tt.expected) {
+			t.Fatalf("instruction has wrong length. want=%d, got=%d",
+				len(tt.expected), len(instruction))
+		}
+
+		for i, b := range tt.expected {
+			if instruction[i] != tt.expected[i] {
+				t.Errorf("wrong byte at pos %d. want=%d, got=%d",
+					i, b, instruction[i])
+			}
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	t.Parallel()
+	instructions := []Instructions{
+		Make(OpAdd),
+		Make(OpGetLocal, 1),
+		Make(OpConstant, 2),
+		Make(OpConstant, 65535),
+		Make(OpClosure, 65535, 255),
+		Make(OpArray, 3),
+	}
+
+	expected := `0000 OpAdd
+0001 OpGetLocal 1
+0003 OpConstant 2
+0008 OpConstant 65535
+0013 OpClosure 65535 255
+0019 OpArray 3
+`
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q",
+			expected, concatted.String())
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{70000}, 4},
+		{OpArray, []int{65535}, 2},
+		{OpGetLocal, []int{255}, 1},
+		{OpClosure, []int{70000, 255}, 5},
+		{OpMatchArray, []int{3, 1}, 3},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		def, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("definition not found: %q\n", err)
+		}
+
+		operandsRead, n := ReadOperands(def, instruction[1:])
+		if n != tt.bytesRead {
+			t.Fatalf("n wrong. want=%d, got=%d", tt.bytesRead, n)
+		}
+
+		for i, want := range tt.operands {
+			if operandsRead[i] != want {
+				t.Errorf("operand wrong. want=%d, got=%d", want, operandsRead[i])
+			}
+		}
+	}
+}
+
+func TestFits(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		operand, width int
+		expected       bool
+	}{
+		{255, 1, true},
+		{256, 1, false},
+		{65535, 2, true},
+		{65536, 2, false},
+		{65536, 4, true},
+		{-1, 4, false},
+	}
+
+	for _, tt := range tests {
+		if got := Fits(tt.operand, tt.width); got != tt.expected {
+			t.Errorf("Fits(%d, %d) wrong. want=%t, got=%t", tt.operand, tt.width, tt.expected, got)
+		}
+	}
+}
+
+func TestSourceMapSpanAt(t *testing.T) {
+	t.Parallel()
+	at := func(line int) token.Span {
+		return token.Span{Start: token.Position{Line: line, Column: 1}}
+	}
+	sm := SourceMap{{Offset: 0, Span: at(1)}, {Offset: 4, Span: at(2)}, {Offset: 9, Span: at(3)}}
+
+	tests := []struct {
+		offset   int
+		expected int
+	}{
+		{0, 1},
+		{3, 1},
+		{4, 2},
+		{8, 2},
+		{9, 3},
+		{100, 3},
+	}
+
+	for _, tt := range tests {
+		if got := sm.SpanAt(tt.offset).Start.Line; got != tt.expected {
+			t.Errorf("wrong line for offset %d. want=%d, got=%d", tt.offset, tt.expected, got)
+		}
+	}
+
+	if span := (SourceMap{}).SpanAt(0); span.IsValid() {
+		t.Errorf("empty source map gave a span: %+v", span)
+	}
+}
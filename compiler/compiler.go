@@ -0,0 +1,911 @@
+package compiler
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/Linkinlog/MagLang/ast"
+	"github.com/Linkinlog/MagLang/code"
+	"github.com/Linkinlog/MagLang/object"
+	"github.com/Linkinlog/MagLang/token"
+)
+
+var infixOperators = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	"<":  code.OpLessThan,
+	">":  code.OpGreaterThan,
+	"<=": code.OpLessEqual,
+	">=": code.OpGreaterEqual,
+}
+
+// Compiler turns a program into bytecode for the vm. Every statement
+// compiles to code that leaves exactly one value on the stack, which is
+// how blocks end up evaluating to their last statement like they do in
+// the evaluator.
+type Compiler struct {
+	constants []object.Object
+	// constantIndexes finds constants already added for a literal's value,
+	// so each one is only stored once.
+	constantIndexes map[constantKey]int
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// span is the source of the node being compiled, which is recorded
+	// against each instruction emitted for it.
+	span token.Span
+
+	// err is the first operand found too big for its instruction. emit
+	// can't return it, so compiling the program checks for it at the end.
+	err error
+}
+
+// constantKey identifies a literal constant by its type and value.
+type constantKey struct {
+	objType object.ObjectType
+	value   any
+}
+
+// CompilationScope holds the instructions of the funk being compiled.
+type CompilationScope struct {
+	instructions code.Instructions
+	positions    code.SourceMap
+	loops        []*loop
+	// tries counts the attempt bodies we're in.
+	tries int
+}
+
+// loop tracks the jumps that enough and anyway need.
+type loop struct {
+	continueTarget int
+	breaks         []int
+	tries          int
+	// depthSlot is the local the stack depth is saved in, or -1 if the loop
+	// has no enough or anyway to unwind for.
+	depthSlot int
+}
+
+type Bytecode struct {
+	Instructions code.Instructions
+	Positions    code.SourceMap
+	Constants    []object.Object
+	// GlobalNames holds the name of each global slot.
+	GlobalNames []string
+	// NumLocals and LocalNames describe the locals of the main frame, used
+	// by sniff arms and fetch handlers outside of any funk.
+	NumLocals  int
+	LocalNames []string
+}
+
+func New() *Compiler {
+	symbolTable := NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
+	return &Compiler{
+		constantIndexes: make(map[constantKey]int),
+		symbolTable:     symbolTable,
+		scopes:          []CompilationScope{{}},
+	}
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	outer := c.span
+	c.span = node.Span()
+	defer func() { c.span = outer }()
+
+	switch node := node.(type) {
+	case *ast.Program:
+		for name := range capturedNames(node) {
+			c.symbolTable.captured[name] = true
+		}
+		c.declare(node)
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+			c.emit(code.OpPop)
+		}
+		if numLocals := c.symbolTable.NumDefinitions(); numLocals > 255 {
+			return fmt.Errorf("too many locals: %d", numLocals)
+		}
+		return c.err
+
+	case *ast.ExpressionStatement:
+		return c.Compile(node.Expression)
+
+	case *ast.BlockStatement:
+		return c.compileBlock(node)
+
+	case *ast.AskStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.storeSymbol(c.declared(node.Name.Value))
+		c.emit(code.OpNull)
+
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.ThrowStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(node)
+
+	case *ast.ForInStatement:
+		return c.compileForInStatement(node)
+
+	case *ast.BreakStatement:
+		l := c.currentLoop()
+		c.leaveIteration(l)
+		l.breaks = append(l.breaks, c.emit(code.OpJump, 9999))
+
+	case *ast.ContinueStatement:
+		l := c.currentLoop()
+		c.leaveIteration(l)
+		c.emit(code.OpJump, l.continueTarget)
+
+	case *ast.IntegerLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: node.Value}))
+
+	case *ast.FloatLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Float{Value: node.Value}))
+
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+
+	case *ast.Boolean:
+		if strings.EqualFold(node.Value, "fact") {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			c.raise("identifier not found: %s", node.Value)
+			return nil
+		}
+		c.loadSymbol(symbol)
+
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
+		}
+		op, ok := infixOperators[node.Operator]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(op)
+
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
+
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+
+	case *ast.MatchExpression:
+		return c.compileMatchExpression(node)
+
+	case *ast.TryExpression:
+		return c.compileTryExpression(node)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node)
+
+	case *ast.CallExpression:
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+		if hasSpread(node.Arguments) {
+			if err := c.compileList(node.Arguments); err != nil {
+				return err
+			}
+			c.emit(code.OpCallSpread)
+			return nil
+		}
+		if len(node.Arguments) > 255 {
+			return fmt.Errorf("too many arguments: %d", len(node.Arguments))
+		}
+		for _, a := range node.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpCall, len(node.Arguments))
+
+	case *ast.ArrayLiteral:
+		return c.compileList(node.Elements)
+
+	case *ast.SpreadExpression:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpSpread)
+
+	case *ast.HashLiteral:
+		keys := []ast.Expression{}
+		for k := range node.Pairs {
+			keys = append(keys, k)
+		}
+		// Map order is random, sort so the same hash compiles the same way.
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+
+		for _, k := range keys {
+			if err := c.Compile(k); err != nil {
+				return err
+			}
+			if err := c.Compile(node.Pairs[k]); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs)*2)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	default:
+		return fmt.Errorf("cannot compile %T", node)
+	}
+
+	return nil
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Positions:    c.scopes[c.scopeIndex].positions,
+		Constants:    c.constants,
+		GlobalNames:  c.symbolTable.GlobalNames(),
+		NumLocals:    c.symbolTable.NumDefinitions(),
+		LocalNames:   c.symbolTable.LocalNames(),
+	}
+}
+
+// compileBlock leaves the value of the block's last statement on the
+// stack, or null if it's empty.
+func (c *Compiler) compileBlock(block *ast.BlockStatement) error {
+	if len(block.Statements) == 0 {
+		c.emit(code.OpNull)
+		return nil
+	}
+
+	for i, s := range block.Statements {
+		if i > 0 {
+			c.emit(code.OpPop)
+		}
+		if err := c.Compile(s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compileLoopBody compiles the statements of a loop, which leave nothing
+// behind on the stack.
+func (c *Compiler) compileLoopBody(block *ast.BlockStatement) error {
+	for _, s := range block.Statements {
+		if err := c.Compile(s); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	}
+
+	return nil
+}
+
+// compileLogicalExpression only evaluates the right side of && and || when
+// the left doesn't already decide the answer, and always gives a boolean.
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if node.Operator == "&&" {
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(code.OpBang)
+		c.emit(code.OpBang)
+		jumpPos := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+		c.emit(code.OpFalse)
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+		return nil
+	}
+
+	c.emit(code.OpTrue)
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+	if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+	c.emit(code.OpBang)
+	c.emit(code.OpBang)
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.Compile(node.Consequence); err != nil {
+		return err
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.Compile(node.Alternative); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	operator := strings.TrimSuffix(node.Operator, "=")
+
+	if target, ok := node.Target.(*ast.IndexExpression); ok {
+		if err := c.Compile(target.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(target.Index); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		if operator == "" {
+			c.emit(code.OpSetIndex)
+		} else {
+			c.emit(code.OpSetIndexOp, int(infixOperators[operator]))
+		}
+		return nil
+	}
+
+	name := node.Target.(*ast.Identifier).Value
+	symbol, ok := c.symbolTable.Resolve(name)
+	if !ok || symbol.Scope == BuiltinScope {
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.raise("cannot assign to undeclared identifier: %s", name)
+		return nil
+	}
+
+	// Like the evaluator, work out the value before looking at what the
+	// name currently holds.
+	if err := c.Compile(node.Value); err != nil {
+		return err
+	}
+	if operator != "" {
+		c.loadSymbol(symbol)
+		c.emit(code.OpSwap)
+		c.emit(infixOperators[operator])
+	}
+
+	c.emit(code.OpDup)
+	c.storeSymbol(symbol)
+
+	return nil
+}
+
+// listChunk is the most elements compileList puts on the stack at once.
+const listChunk = 1 << 12
+
+// compileList leaves an array of the elements on the stack. Spread
+// elements, and long lists in chunks of listChunk, are joined in with
+// OpConcat.
+func (c *Compiler) compileList(elements []ast.Expression) error {
+	if !hasSpread(elements) && len(elements) <= listChunk {
+		for _, el := range elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(elements))
+		return nil
+	}
+
+	parts, pending := 0, 0
+	flush := func() {
+		if pending > 0 {
+			c.emit(code.OpArray, pending)
+			parts, pending = parts+1, 0
+		}
+	}
+
+	for _, el := range elements {
+		if _, ok := el.(*ast.SpreadExpression); ok {
+			flush()
+			parts++
+		} else {
+			if pending == listChunk {
+				flush()
+			}
+			pending++
+		}
+		if err := c.Compile(el); err != nil {
+			return err
+		}
+	}
+	flush()
+	c.emit(code.OpConcat, parts)
+
+	return nil
+}
+
+func hasSpread(elements []ast.Expression) bool {
+	for _, el := range elements {
+		if _, ok := el.(*ast.SpreadExpression); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Compiler) compileWhileStatement(node *ast.WhileStatement) error {
+	l := c.newLoop(node.Body)
+
+	// The condition is outside the loop as far as enough and anyway go.
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+	exitPos := c.emit(code.OpJumpNotTruthy, 9999)
+	c.enterLoop(l)
+
+	if err := c.compileLoopBody(node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, l.continueTarget)
+
+	c.changeOperand(exitPos, len(c.currentInstructions()))
+	c.leaveLoop()
+	c.emit(code.OpNull)
+
+	return nil
+}
+
+// compileForInStatement keeps an iterator on the stack for the length of
+// the loop, which OpIterNext pulls each key and value from.
+func (c *Compiler) compileForInStatement(node *ast.ForInStatement) error {
+	if err := c.Compile(node.Iterable); err != nil {
+		return err
+	}
+	keyed := 0
+	if node.Key != nil {
+		keyed = 1
+	}
+	c.emit(code.OpIter, keyed)
+
+	l := c.newLoop(node.Body)
+	c.enterLoop(l)
+	exitPos := c.emit(code.OpIterNext, 9999)
+
+	c.storeSymbol(c.declared(node.Value.Value))
+	if node.Key != nil {
+		c.storeSymbol(c.declared(node.Key.Value))
+	} else {
+		c.emit(code.OpPop)
+	}
+
+	if err := c.compileLoopBody(node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, l.continueTarget)
+
+	c.changeOperand(exitPos, len(c.currentInstructions()))
+	c.leaveLoop()
+	c.emit(code.OpPop)
+	c.emit(code.OpNull)
+
+	return nil
+}
+
+// newLoop starts a loop over body, whose next iteration starts at the
+// current position. Its body goes between enterLoop and leaveLoop.
+func (c *Compiler) newLoop(body *ast.BlockStatement) *loop {
+	l := &loop{tries: c.scopes[c.scopeIndex].tries, depthSlot: -1}
+
+	// enough and anyway can come in the middle of an expression, with its
+	// operands still on the stack, so remember where the stack should be.
+	if hasLoopJumps(body) {
+		l.depthSlot = c.symbolTable.reserveLocal("$depth")
+		c.emit(code.OpMarkStack, l.depthSlot)
+	}
+
+	l.continueTarget = len(c.currentInstructions())
+	return l
+}
+
+func (c *Compiler) enterLoop(l *loop) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, l)
+}
+
+// leaveLoop points the loop's enough jumps at the current position.
+func (c *Compiler) leaveLoop() {
+	scope := &c.scopes[c.scopeIndex]
+	l := scope.loops[len(scope.loops)-1]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+
+	for _, pos := range l.breaks {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+}
+
+func (c *Compiler) currentLoop() *loop {
+	loops := c.scopes[c.scopeIndex].loops
+	return loops[len(loops)-1]
+}
+
+// leaveIteration closes the attempts that jumping out of the current
+// iteration of l leaves, and drops whatever is on the stack above the loop.
+func (c *Compiler) leaveIteration(l *loop) {
+	for i := l.tries; i < c.scopes[c.scopeIndex].tries; i++ {
+		c.emit(code.OpEndTry)
+	}
+	c.emit(code.OpUnwindStack, l.depthSlot)
+}
+
+// compileTryExpression registers a handler for the length of the body.
+// If anything in it fails, the vm unwinds to the handler with the error
+// hash on the stack.
+func (c *Compiler) compileTryExpression(node *ast.TryExpression) error {
+	tryPos := c.emit(code.OpTry, 9999)
+
+	c.scopes[c.scopeIndex].tries++
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	c.scopes[c.scopeIndex].tries--
+
+	c.emit(code.OpEndTry)
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(tryPos, len(c.currentInstructions()))
+
+	c.enterBlock(node.Handler)
+	if node.Param != nil {
+		c.defineBinding(node.Param.Value)
+	} else {
+		c.emit(code.OpPop)
+	}
+	if err := c.Compile(node.Handler); err != nil {
+		return err
+	}
+	c.leaveBlock()
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral) error {
+	c.enterScope(capturedNames(node))
+
+	// The parameters take the first slots, in order, but each only comes
+	// into view once its default is compiled, so a default sees the
+	// parameters before it and otherwise the names around the funk.
+	params := make([]Symbol, len(node.Parameters))
+	for i, p := range node.Parameters {
+		params[i] = c.symbolTable.reserve(p.Value)
+	}
+	var rest Symbol
+	if node.Rest != nil {
+		rest = c.symbolTable.reserve(node.Rest.Value)
+	}
+
+	for i, p := range node.Parameters {
+		if def, ok := node.Defaults[p.Value]; ok {
+			jumpPos := c.emit(code.OpJumpIfArg, i, 9999)
+			if err := c.Compile(def); err != nil {
+				return err
+			}
+			c.emit(code.OpSetLocal, i)
+			c.changeOperand(jumpPos, len(c.currentInstructions()))
+		}
+		c.bindParameter(params[i])
+	}
+	if node.Rest != nil {
+		c.bindParameter(rest)
+	}
+
+	c.declare(node.Body)
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.NumDefinitions()
+	if numLocals > 255 {
+		return fmt.Errorf("too many locals in %s: %d", node.Name, numLocals)
+	}
+	localNames := c.symbolTable.LocalNames()
+	positions := c.scopes[c.scopeIndex].positions
+	instructions := c.leaveScope()
+
+	freeNames := make([]string, len(freeSymbols))
+	for i, s := range freeSymbols {
+		freeNames[i] = s.Name
+		if s.Scope == LocalScope {
+			c.emit(code.OpLoadCell, s.Index)
+		} else {
+			c.emit(code.OpLoadFreeCell, s.Index)
+		}
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		Positions:     positions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		NumDefaults:   len(node.Defaults),
+		Rest:          node.Rest != nil,
+		Name:          node.Name,
+		LocalNames:    localNames,
+		FreeNames:     freeNames,
+	}
+	c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+
+	return nil
+}
+
+// bindParameter makes a parameter visible, moving it into a cell first if
+// a closure might capture it.
+func (c *Compiler) bindParameter(symbol Symbol) {
+	c.symbolTable.store[symbol.Name] = symbol
+	if symbol.Boxed {
+		c.emit(code.OpGetLocal, symbol.Index)
+		c.emit(code.OpSetCell, symbol.Index)
+	}
+}
+
+// declare hoists the names bound in node's scope, see declarations.
+func (c *Compiler) declare(node ast.Node) {
+	for _, name := range declarations(node) {
+		c.symbolTable.hoist(name)
+	}
+}
+
+// declared binds name in the slot declare gave it, once its value has been
+// compiled.
+func (c *Compiler) declared(name string) Symbol {
+	return c.symbolTable.bind(name)
+}
+
+// enterBlock starts a block table for a sniff arm or fetch handler made up
+// of nodes. Locals in it that closures might capture get a fresh cell each
+// time the block runs, like the evaluator gives each run a fresh
+// environment.
+func (c *Compiler) enterBlock(nodes ...ast.Node) {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+	for _, node := range nodes {
+		for _, name := range declarations(node) {
+			symbol := c.symbolTable.hoist(name)
+			if symbol.Boxed {
+				c.emit(code.OpFreshCell, symbol.Index)
+			}
+		}
+	}
+}
+
+func (c *Compiler) leaveBlock() {
+	c.symbolTable = c.symbolTable.Outer
+}
+
+// defineBinding defines name in the current block and stores the value on
+// top of the stack in it.
+func (c *Compiler) defineBinding(name string) {
+	symbol := c.symbolTable.Define(name)
+	if symbol.Boxed {
+		c.emit(code.OpFreshCell, symbol.Index)
+	}
+	c.storeSymbol(symbol)
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		if s.Boxed {
+			c.emit(code.OpGetCell, s.Index)
+		} else {
+			c.emit(code.OpGetLocal, s.Index)
+		}
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	}
+}
+
+func (c *Compiler) storeSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		if s.Boxed {
+			c.emit(code.OpSetCell, s.Index)
+		} else {
+			c.emit(code.OpSetLocal, s.Index)
+		}
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Index)
+	}
+}
+
+// raise emits code that fails with the message when it runs.
+func (c *Compiler) raise(format string, a ...any) {
+	message := &object.String{Value: fmt.Sprintf(format, a...)}
+	c.emit(code.OpRaise, c.addConstant(message))
+}
+
+// addConstant returns the index of obj among the constants, reusing the
+// index of an equal literal if there is one.
+func (c *Compiler) addConstant(obj object.Object) int {
+	key, literal := literalKey(obj)
+	if index, ok := c.constantIndexes[key]; literal && ok {
+		return index
+	}
+
+	c.constants = append(c.constants, obj)
+	if literal {
+		c.constantIndexes[key] = len(c.constants) - 1
+	}
+	return len(c.constants) - 1
+}
+
+// literalKey returns the key of obj if it's a literal that can be shared.
+// Floats are keyed by their bits so 0.0 and -0.0 stay apart.
+func literalKey(obj object.Object) (constantKey, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return constantKey{obj.Type(), obj.Value}, true
+	case *object.Float:
+		return constantKey{obj.Type(), math.Float64bits(obj.Value)}, true
+	case *object.String:
+		return constantKey{obj.Type(), obj.Value}, true
+	}
+	return constantKey{}, false
+}
+
+// checkOperands records an error if an operand doesn't fit the width the
+// instruction has for it.
+func (c *Compiler) checkOperands(op code.Opcode, operands []int) {
+	def, err := code.Lookup(byte(op))
+	if err != nil || c.err != nil {
+		return
+	}
+
+	for i, operand := range operands {
+		if width := def.OperandWidths[i]; !code.Fits(operand, width) {
+			c.err = fmt.Errorf("%s: too big to compile: %s needs %d, the most it takes is %d",
+				c.span, def.Name, operand, 1<<(8*width)-1)
+			return
+		}
+	}
+}
+
+// emit adds an instruction to the current scope and returns its position.
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands)
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	scope := &c.scopes[c.scopeIndex]
+	if n := len(scope.positions); n == 0 || scope.positions[n-1].Span != c.span {
+		scope.positions = append(scope.positions, code.Position{Offset: pos, Span: c.span})
+	}
+
+	return pos
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	return posNewInstruction
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+// changeOperand rewrites the last operand of the instruction at pos, which
+// is always the jump target for the instructions we patch.
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	def, _ := code.Lookup(byte(op))
+
+	operands, _ := code.ReadOperands(def, c.currentInstructions()[opPos+1:])
+	operands[len(operands)-1] = operand
+	c.checkOperands(op, operands)
+
+	c.replaceInstruction(opPos, code.Make(op, operands...))
+}
+
+func (c *Compiler) enterScope(captured map[string]bool) {
+	c.scopes = append(c.scopes, CompilationScope{})
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+	c.symbolTable.captured = captured
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
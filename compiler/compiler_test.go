@@ -0,0 +1,448 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Linkinlog/MagLang/ast"
+	"github.com/Linkinlog/MagLang/code"
+	"github.com/Linkinlog/MagLang/lexer"
+	"github.com/Linkinlog/MagLang/object"
+	"github.com/Linkinlog/MagLang/parser"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []any
+	expectedInstructions []code.Instructions
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	t.Parallel()
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []any{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "-1",
+			expectedConstants: []any{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestCompoundAssignment(t *testing.T) {
+	t.Parallel()
+	tests := []compilerTestCase{
+		{
+			input:             "ask x = 1; x += 2;",
+			expectedConstants: []any{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpSwap),
+				code.Make(code.OpAdd),
+				code.Make(code.OpDup),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "ask a = [1]; a[0] = 2; a[0] *= 3;",
+			expectedConstants: []any{1, 0, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpSetIndexOp, int(code.OpMul)),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	t.Parallel()
+	tests := []compilerTestCase{
+		{
+			input:             "consider (fact) { 10 }; 3333;",
+			expectedConstants: []any{10, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 16),
+				// 0006
+				code.Make(code.OpConstant, 0),
+				// 0011
+				code.Make(code.OpJump, 17),
+				// 0016
+				code.Make(code.OpNull),
+				// 0017
+				code.Make(code.OpPop),
+				// 0018
+				code.Make(code.OpConstant, 1),
+				// 0023
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "consider (fact) { 10 } however { 20 }; 3333;",
+			expectedConstants: []any{10, 20, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 16),
+				// 0006
+				code.Make(code.OpConstant, 0),
+				// 0011
+				code.Make(code.OpJump, 21),
+				// 0016
+				code.Make(code.OpConstant, 1),
+				// 0021
+				code.Make(code.OpPop),
+				// 0022
+				code.Make(code.OpConstant, 2),
+				// 0027
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestWhileLoops(t *testing.T) {
+	t.Parallel()
+	tests := []compilerTestCase{
+		{
+			input:             "whilst (fact) { 1 }",
+			expectedConstants: []any{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 17),
+				// 0006
+				code.Make(code.OpConstant, 0),
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpJump, 0),
+				// 0017
+				code.Make(code.OpNull),
+				// 0018
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestCells(t *testing.T) {
+	t.Parallel()
+	tests := []compilerTestCase{
+		{
+			input: "funk(a) { funk(b) { a + b } }",
+			expectedConstants: []any{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpSetCell, 0),
+					code.Make(code.OpLoadCell, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "funk() { ask n = 0; funk() { n += 1 } }",
+			expectedConstants: []any{
+				0,
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpSwap),
+					code.Make(code.OpAdd),
+					code.Make(code.OpDup),
+					code.Make(code.OpSetFree, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetCell, 0),
+					code.Make(code.OpNull),
+					code.Make(code.OpPop),
+					code.Make(code.OpLoadCell, 0),
+					code.Make(code.OpClosure, 2, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestSpread(t *testing.T) {
+	t.Parallel()
+	tests := []compilerTestCase{
+		{
+			input:             "[1, ...[2], 3]",
+			expectedConstants: []any{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSpread),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpConcat, 3),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "ask f = funk(...xs) { xs }; f(1, ...[2])",
+			expectedConstants: []any{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				2,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSpread),
+				code.Make(code.OpConcat, 2),
+				code.Make(code.OpCallSpread),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConstantsAreShared(t *testing.T) {
+	t.Parallel()
+	tests := []compilerTestCase{
+		{
+			input:             `1 + 1; "a" + "a"; 1.5; 1.5`,
+			expectedConstants: []any{1, "a", 1.5},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestOperandLimits(t *testing.T) {
+	t.Parallel()
+
+	// Past 65535 constants and instructions, indexes and jump targets
+	// still have to come out right.
+	var input strings.Builder
+	input.WriteString("ask x = 0; consider (cap) {\n")
+	for i := 0; i < 70000; i++ {
+		fmt.Fprintf(&input, "x = %d;\n", i)
+	}
+	input.WriteString("}")
+
+	program := parse(input.String())
+	compiler := New()
+	if err := compiler.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+	if len(bytecode.Constants) != 70000 {
+		t.Errorf("wrong number of constants. want=70000, got=%d", len(bytecode.Constants))
+	}
+
+	def, _ := code.Lookup(bytecode.Instructions[len(bytecode.Instructions)-1])
+	if def.Name != "OpPop" {
+		t.Errorf("program should end in OpPop, got %s", def.Name)
+	}
+
+	keys := make([]string, 40000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%d: 1", i)
+	}
+	program = parse("{" + strings.Join(keys, ", ") + "}")
+	err := New().Compile(program)
+	if err == nil {
+		t.Fatalf("expected a compiler error for a huge hash literal")
+	}
+	expected := "1:1: too big to compile: OpHash needs 80000, the most it takes is 65535"
+	if err.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%q", expected, err.Error())
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+
+		err = testInstructions(tt.expectedInstructions, bytecode.Instructions)
+		if err != nil {
+			t.Fatalf("testInstructions failed for %q: %s", tt.input, err)
+		}
+
+		err = testConstants(tt.expectedConstants, bytecode.Constants)
+		if err != nil {
+			t.Fatalf("testConstants failed for %q: %s", tt.input, err)
+		}
+	}
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+
+	return out
+}
+
+func testInstructions(expected []code.Instructions, actual code.Instructions) error {
+	concatted := concatInstructions(expected)
+
+	if len(actual) != len(concatted) {
+		return fmt.Errorf("wrong instructions length.\nwant=\n%s\ngot=\n%s",
+			concatted, actual)
+	}
+
+	for i, ins := range concatted {
+		if actual[i] != ins {
+			return fmt.Errorf("wrong instruction at %d.\nwant=\n%s\ngot=\n%s",
+				i, concatted, actual)
+		}
+	}
+
+	return nil
+}
+
+func testConstants(expected []any, actual []object.Object) error {
+	if len(expected) != len(actual) {
+		return fmt.Errorf("wrong number of constants. got=%d, want=%d",
+			len(actual), len(expected))
+	}
+
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			result, ok := actual[i].(*object.Integer)
+			if !ok || result.Value != int64(constant) {
+				return fmt.Errorf("constant %d - wrong integer. want=%d, got=%s",
+					i, constant, actual[i].Inspect())
+			}
+		case float64:
+			result, ok := actual[i].(*object.Float)
+			if !ok || result.Value != constant {
+				return fmt.Errorf("constant %d - wrong float. want=%g, got=%s",
+					i, constant, actual[i].Inspect())
+			}
+		case string:
+			result, ok := actual[i].(*object.String)
+			if !ok || result.Value != constant {
+				return fmt.Errorf("constant %d - wrong string. want=%q, got=%s",
+					i, constant, actual[i].Inspect())
+			}
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				return fmt.Errorf("constant %d - not a function: %T", i, actual[i])
+			}
+			if err := testInstructions(constant, fn.Instructions); err != nil {
+				return fmt.Errorf("constant %d - testInstructions failed: %s", i, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package compiler
+
+import (
+	"sort"
+
+	"github.com/Linkinlog/MagLang/ast"
+	"github.com/Linkinlog/MagLang/code"
+	"github.com/Linkinlog/MagLang/object"
+)
+
+// compileMatchExpression tries each arm in turn, jumping to the next one
+// as soon as the pattern or guard fails. The subject is kept in a hidden
+// slot so patterns can load the parts of it they look at.
+func (c *Compiler) compileMatchExpression(node *ast.MatchExpression) error {
+	if err := c.Compile(node.Subject); err != nil {
+		return err
+	}
+
+	c.enterBlock()
+	defer c.leaveBlock()
+
+	// The name can't clash with anything the program defines.
+	subject := c.symbolTable.Define("$subject")
+	c.storeSymbol(subject)
+	load := func() { c.loadSymbol(subject) }
+
+	ends := []int{}
+	for _, arm := range node.Arms {
+		end, err := c.compileMatchArm(arm, load)
+		if err != nil {
+			return err
+		}
+		ends = append(ends, end)
+	}
+
+	load()
+	c.emit(code.OpNoMatch)
+
+	for _, pos := range ends {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+
+	return nil
+}
+
+// compileMatchArm returns the position of the jump past the other arms
+// taken when the arm matches.
+func (c *Compiler) compileMatchArm(arm *ast.MatchArm, load func()) (int, error) {
+	if arm.Guard != nil {
+		c.enterBlock(arm.Guard, arm.Body)
+	} else {
+		c.enterBlock(arm.Body)
+	}
+	defer c.leaveBlock()
+
+	fails := []int{}
+	if err := c.compilePattern(arm.Pattern, load, &fails); err != nil {
+		return 0, err
+	}
+
+	if arm.Guard != nil {
+		if err := c.Compile(arm.Guard); err != nil {
+			return 0, err
+		}
+		fails = append(fails, c.emit(code.OpJumpNotTruthy, 9999))
+	}
+
+	if err := c.Compile(arm.Body); err != nil {
+		return 0, err
+	}
+	end := c.emit(code.OpJump, 9999)
+
+	for _, pos := range fails {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+
+	return end, nil
+}
+
+// compilePattern emits the checks that the value pushed by load fits
+// pattern, adding a jump to fails for each, and binds the pattern's names.
+func (c *Compiler) compilePattern(pattern ast.Expression, load func(), fails *[]int) error {
+	fail := func() {
+		*fails = append(*fails, c.emit(code.OpJumpNotTruthy, 9999))
+	}
+
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			load()
+			c.defineBinding(pattern.Value)
+		}
+
+	case *ast.ArrayLiteral:
+		elements := pattern.Elements
+		var rest *ast.Identifier
+		if len(elements) > 0 {
+			if spread, ok := elements[len(elements)-1].(*ast.SpreadExpression); ok {
+				rest = spread.Value.(*ast.Identifier)
+				elements = elements[:len(elements)-1]
+			}
+		}
+
+		hasRest := 0
+		if rest != nil {
+			hasRest = 1
+		}
+		load()
+		c.emit(code.OpMatchArray, len(elements), hasRest)
+		fail()
+
+		for i, element := range elements {
+			index := c.addConstant(&object.Integer{Value: int64(i)})
+			loadElement := func() {
+				load()
+				c.emit(code.OpConstant, index)
+				c.emit(code.OpIndex)
+			}
+			if err := c.compilePattern(element, loadElement, fails); err != nil {
+				return err
+			}
+		}
+
+		if rest != nil && rest.Value != "_" {
+			load()
+			c.emit(code.OpRest, len(elements))
+			c.defineBinding(rest.Value)
+		}
+
+	case *ast.HashLiteral:
+		load()
+		c.emit(code.OpMatchHash)
+		fail()
+
+		keys := []ast.Expression{}
+		for k := range pattern.Pairs {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+
+		for _, key := range keys {
+			load()
+			if err := c.Compile(key); err != nil {
+				return err
+			}
+			c.emit(code.OpHasKey)
+			fail()
+
+			loadValue := func() {
+				load()
+				// Keys are literals, so compiling them can't fail.
+				_ = c.Compile(key)
+				c.emit(code.OpIndex)
+			}
+			if err := c.compilePattern(pattern.Pairs[key], loadValue, fails); err != nil {
+				return err
+			}
+		}
+
+	default:
+		load()
+		if err := c.Compile(pattern); err != nil {
+			return err
+		}
+		c.emit(code.OpMatchEqual)
+		fail()
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package compiler
+
+import "github.com/Linkinlog/MagLang/ast"
+
+// walk calls visit for node and, as long as visit returns true, for each
+// of its children in turn.
+func walk(node ast.Node, visit func(ast.Node) bool) {
+	if !visit(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			walk(s, visit)
+		}
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			walk(s, visit)
+		}
+	case *ast.ExpressionStatement:
+		walk(node.Expression, visit)
+	case *ast.AskStatement:
+		walk(node.Name, visit)
+		walk(node.Value, visit)
+	case *ast.ReturnStatement:
+		walk(node.ReturnValue, visit)
+	case *ast.ThrowStatement:
+		walk(node.Value, visit)
+	case *ast.WhileStatement:
+		walk(node.Condition, visit)
+		walk(node.Body, visit)
+	case *ast.ForInStatement:
+		if node.Key != nil {
+			walk(node.Key, visit)
+		}
+		walk(node.Value, visit)
+		walk(node.Iterable, visit)
+		walk(node.Body, visit)
+	case *ast.PrefixExpression:
+		walk(node.Right, visit)
+	case *ast.InfixExpression:
+		walk(node.Left, visit)
+		walk(node.Right, visit)
+	case *ast.AssignExpression:
+		walk(node.Target, visit)
+		walk(node.Value, visit)
+	case *ast.IfExpression:
+		walk(node.Condition, visit)
+		walk(node.Consequence, visit)
+		if node.Alternative != nil {
+			walk(node.Alternative, visit)
+		}
+	case *ast.MatchExpression:
+		walk(node.Subject, visit)
+		for _, arm := range node.Arms {
+			walk(arm.Pattern, visit)
+			if arm.Guard != nil {
+				walk(arm.Guard, visit)
+			}
+			walk(arm.Body, visit)
+		}
+	case *ast.TryExpression:
+		walk(node.Body, visit)
+		if node.Param != nil {
+			walk(node.Param, visit)
+		}
+		walk(node.Handler, visit)
+	case *ast.FunctionLiteral:
+		for _, p := range node.Parameters {
+			walk(p, visit)
+			if def, ok := node.Defaults[p.Value]; ok {
+				walk(def, visit)
+			}
+		}
+		if node.Rest != nil {
+			walk(node.Rest, visit)
+		}
+		walk(node.Body, visit)
+	case *ast.CallExpression:
+		walk(node.Function, visit)
+		for _, arg := range node.Arguments {
+			walk(arg, visit)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			walk(el, visit)
+		}
+	case *ast.SpreadExpression:
+		walk(node.Value, visit)
+	case *ast.IndexExpression:
+		walk(node.Left, visit)
+		walk(node.Index, visit)
+	case *ast.HashLiteral:
+		for key, value := range node.Pairs {
+			walk(key, visit)
+			walk(value, visit)
+		}
+	}
+}
+
+// declarations returns the names that asks and peruse loops within node
+// bind in node's own scope, leaving out those in nested funks, sniff arms
+// and fetch handlers, which have scopes of their own. Defining them all up
+// front lets a funk refer to a name that's only bound further down.
+func declarations(node ast.Node) []string {
+	var names []string
+
+	var visit func(ast.Node) bool
+	visit = func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.AskStatement:
+			names = append(names, node.Name.Value)
+		case *ast.ForInStatement:
+			if node.Key != nil {
+				names = append(names, node.Key.Value)
+			}
+			names = append(names, node.Value.Value)
+		case *ast.FunctionLiteral:
+			return false
+		case *ast.MatchExpression:
+			walk(node.Subject, visit)
+			return false
+		case *ast.TryExpression:
+			walk(node.Body, visit)
+			return false
+		}
+		return true
+	}
+	walk(node, visit)
+
+	return names
+}
+
+// capturedNames returns every name mentioned by a funk nested somewhere in
+// node. Locals going by one of these names might be captured, so they're
+// boxed.
+func capturedNames(node ast.Node) map[string]bool {
+	names := make(map[string]bool)
+
+	walk(node, func(n ast.Node) bool {
+		fn, ok := n.(*ast.FunctionLiteral)
+		if !ok || n == node {
+			return true
+		}
+
+		walk(fn, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Identifier); ok {
+				names[ident.Value] = true
+			}
+			return true
+		})
+		return false
+	})
+
+	return names
+}
+
+// hasLoopJumps reports whether body has an enough or anyway for its loop,
+// rather than for a loop or funk nested inside it.
+func hasLoopJumps(body *ast.BlockStatement) bool {
+	found := false
+	var visit func(ast.Node) bool
+	visit = func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.BreakStatement, *ast.ContinueStatement:
+			found = true
+		case *ast.FunctionLiteral:
+			return false
+		case *ast.WhileStatement:
+			walk(node.Condition, visit)
+			return false
+		case *ast.ForInStatement:
+			walk(node.Iterable, visit)
+			return false
+		}
+		return !found
+	}
+	walk(body, visit)
+	return found
+}
@@ -0,0 +1,198 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	BuiltinScope SymbolScope = "BUILTIN"
+	FreeScope    SymbolScope = "FREE"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	// Boxed is set on locals that a closure captures, which are kept in a
+	// cell so assignments on either side are seen by the other.
+	Boxed bool
+}
+
+// SymbolTable resolves names to the slots holding them. Each funk gets its
+// own table, and sniff arms and fetch handlers get a block table, whose
+// names are only visible inside it but which shares its funk's slots.
+// Block tables in the program itself get locals of the main frame rather
+// than globals, so closures capture them like any other local.
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	FreeSymbols []Symbol
+
+	store map[string]Symbol
+	// hoisted holds the names given a slot up front, see hoist, that the
+	// ask binding them hasn't been compiled for yet.
+	hoisted map[string]Symbol
+	// globals and locals hold the name defined in each slot.
+	globals []string
+	locals  []string
+	block   bool
+	// captured holds the names that closures inside the funk refer to.
+	captured map[string]bool
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{
+		store:    make(map[string]Symbol),
+		hoisted:  make(map[string]Symbol),
+		captured: make(map[string]bool),
+	}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewEnclosedSymbolTable(outer)
+	s.block = true
+	return s
+}
+
+// Define binds name in this table. Defining a name twice reuses its slot,
+// like asking for an existing name in the evaluator overwrites it.
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+		return symbol
+	}
+
+	symbol := s.reserve(name)
+	s.store[name] = symbol
+	return symbol
+}
+
+// hoist gives name a slot before the ask binding it is compiled, so funks
+// nested above that ask can refer to it. Until bind is called, code in this
+// table still resolves name to whatever it meant outside, like the
+// evaluator only finding a name in an environment once it's been set.
+func (s *SymbolTable) hoist(name string) Symbol {
+	if symbol, ok := s.store[name]; ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+		return symbol
+	}
+	if symbol, ok := s.hoisted[name]; ok {
+		return symbol
+	}
+
+	symbol := s.reserve(name)
+	s.hoisted[name] = symbol
+	return symbol
+}
+
+// bind makes name visible in this table, in the slot hoist gave it if it
+// was hoisted.
+func (s *SymbolTable) bind(name string) Symbol {
+	if symbol, ok := s.hoisted[name]; ok {
+		delete(s.hoisted, name)
+		s.store[name] = symbol
+		return symbol
+	}
+	return s.Define(name)
+}
+
+// reserve allocates a slot for name without making it visible yet.
+func (s *SymbolTable) reserve(name string) Symbol {
+	fn := s.function()
+
+	if fn.Outer == nil && !s.block {
+		fn.globals = append(fn.globals, name)
+		return Symbol{Name: name, Scope: GlobalScope, Index: len(fn.globals) - 1}
+	}
+
+	fn.locals = append(fn.locals, name)
+	return Symbol{Name: name, Scope: LocalScope, Index: len(fn.locals) - 1, Boxed: fn.captured[name]}
+}
+
+// reserveLocal allocates a local slot for the compiler's own use, even at
+// the top of the program where names would get globals.
+func (s *SymbolTable) reserveLocal(name string) int {
+	fn := s.function()
+	fn.locals = append(fn.locals, name)
+	return len(fn.locals) - 1
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1}
+	symbol.Scope = FreeScope
+
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	return s.resolve(name, false)
+}
+
+// resolve looks name up, with nested set once the lookup has left the funk
+// it started in. A nested funk only runs once it's called, so it sees the
+// names hoisted around it even if their ask comes further down.
+func (s *SymbolTable) resolve(name string, nested bool) (Symbol, bool) {
+	hoisted, isHoisted := s.hoisted[name]
+	if isHoisted && nested {
+		return hoisted, true
+	}
+
+	symbol, ok := s.store[name]
+	if ok {
+		return symbol, ok
+	}
+	if s.Outer == nil {
+		return hoisted, isHoisted
+	}
+
+	symbol, ok = s.Outer.resolve(name, nested || !s.block)
+	if !ok {
+		return hoisted, isHoisted
+	}
+	if s.block {
+		return symbol, ok
+	}
+
+	if symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+		return symbol, ok
+	}
+
+	return s.defineFree(symbol), true
+}
+
+// NumDefinitions is how many local slots the funk needs, counting those
+// of its block tables.
+func (s *SymbolTable) NumDefinitions() int {
+	return len(s.function().locals)
+}
+
+// LocalNames returns the name defined in each local slot.
+func (s *SymbolTable) LocalNames() []string {
+	return s.function().locals
+}
+
+// GlobalNames returns the name defined in each global slot.
+func (s *SymbolTable) GlobalNames() []string {
+	return s.function().globals
+}
+
+// function returns the table of the funk, or program, s belongs to.
+func (s *SymbolTable) function() *SymbolTable {
+	for s.block {
+		s = s.Outer
+	}
+	return s
+}
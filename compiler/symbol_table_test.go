@@ -0,0 +1,121 @@
+package compiler
+
+import "testing"
+
+func TestDefine(t *testing.T) {
+	t.Parallel()
+	global := NewSymbolTable()
+	a := global.Define("a")
+	if a != (Symbol{Name: "a", Scope: GlobalScope, Index: 0}) {
+		t.Errorf("a wrong. got=%+v", a)
+	}
+	if again := global.Define("a"); again != a {
+		t.Errorf("redefining a gave a new slot. got=%+v", again)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	local.captured["c"] = true
+	b := local.Define("b")
+	if b != (Symbol{Name: "b", Scope: LocalScope, Index: 0}) {
+		t.Errorf("b wrong. got=%+v", b)
+	}
+	c := local.Define("c")
+	if c != (Symbol{Name: "c", Scope: LocalScope, Index: 1, Boxed: true}) {
+		t.Errorf("c wrong. got=%+v", c)
+	}
+}
+
+func TestResolveFree(t *testing.T) {
+	t.Parallel()
+	global := NewSymbolTable()
+	global.Define("a")
+
+	first := NewEnclosedSymbolTable(global)
+	first.Define("b")
+
+	second := NewEnclosedSymbolTable(first)
+	second.Define("c")
+
+	tests := []struct {
+		name     string
+		expected Symbol
+	}{
+		{"a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{"b", Symbol{Name: "b", Scope: FreeScope, Index: 0}},
+		{"c", Symbol{Name: "c", Scope: LocalScope, Index: 0}},
+	}
+
+	for _, tt := range tests {
+		result, ok := second.Resolve(tt.name)
+		if !ok {
+			t.Fatalf("name %s not resolvable", tt.name)
+		}
+		if result != tt.expected {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", tt.name, tt.expected, result)
+		}
+	}
+
+	if len(second.FreeSymbols) != 1 || second.FreeSymbols[0].Name != "b" {
+		t.Errorf("wrong free symbols. got=%+v", second.FreeSymbols)
+	}
+
+	if _, ok := first.Resolve("c"); ok {
+		t.Errorf("c resolvable outside its funk")
+	}
+}
+
+func TestBlockSymbolTable(t *testing.T) {
+	t.Parallel()
+	global := NewSymbolTable()
+	global.Define("a")
+
+	block := NewBlockSymbolTable(global)
+	b := block.Define("b")
+	if b != (Symbol{Name: "b", Scope: LocalScope, Index: 0}) {
+		t.Errorf("top level block name should be a main frame local. got=%+v", b)
+	}
+
+	fn := NewEnclosedSymbolTable(global)
+	fn.Define("x")
+	inner := NewBlockSymbolTable(fn)
+	y := inner.Define("y")
+	if y != (Symbol{Name: "y", Scope: LocalScope, Index: 1}) {
+		t.Errorf("block should share its funk's slots. got=%+v", y)
+	}
+	if x, _ := inner.Resolve("x"); x.Scope != LocalScope {
+		t.Errorf("block turned its funk's local into a free one. got=%+v", x)
+	}
+	if fn.NumDefinitions() != 2 {
+		t.Errorf("funk should count its block's locals. got=%d", fn.NumDefinitions())
+	}
+	if _, ok := fn.Resolve("y"); ok {
+		t.Errorf("y resolvable outside its block")
+	}
+}
+
+func TestHoisting(t *testing.T) {
+	t.Parallel()
+	global := NewSymbolTable()
+	outer := global.Define("x")
+
+	fn := NewEnclosedSymbolTable(global)
+	hoisted := fn.hoist("x")
+	if hoisted != (Symbol{Name: "x", Scope: LocalScope, Index: 0}) {
+		t.Errorf("hoisted name should get a local. got=%+v", hoisted)
+	}
+	if x, _ := fn.Resolve("x"); x != outer {
+		t.Errorf("x should mean the global until it's bound. got=%+v", x)
+	}
+
+	nested := NewEnclosedSymbolTable(fn)
+	if x, _ := nested.Resolve("x"); x.Scope != FreeScope || nested.FreeSymbols[0] != hoisted {
+		t.Errorf("nested funk should capture the hoisted local. got=%+v", x)
+	}
+
+	if bound := fn.bind("x"); bound != hoisted {
+		t.Errorf("bind should use the hoisted slot. got=%+v", bound)
+	}
+	if x, _ := fn.Resolve("x"); x != hoisted {
+		t.Errorf("x should be the local once bound. got=%+v", x)
+	}
+}
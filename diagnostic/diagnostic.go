@@ -0,0 +1,134 @@
+package diagnostic
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Linkinlog/MagLang/token"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Hint
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Hint:
+		return "hint"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// Code identifies the kind of problem, so tooling can match on it without
+// parsing messages. L codes come from the lexer, P codes from the parser.
+type Code string
+
+const (
+	UnterminatedComment Code = "L001"
+	UnterminatedString  Code = "L002"
+	InvalidEscape       Code = "L003"
+
+	UnexpectedToken     Code = "P001"
+	NoPrefixParseFn     Code = "P002"
+	InvalidIntLiteral   Code = "P003"
+	InvalidFloatLiteral Code = "P004"
+	MissingDefault      Code = "P005"
+	RestNotLast         Code = "P006"
+	InvalidAssignTarget Code = "P007"
+	OutsideLoop         Code = "P008"
+	InvalidPattern      Code = "P009"
+)
+
+// Diagnostic is a single problem found in the source.
+type Diagnostic struct {
+	Severity Severity
+	Code     Code
+	Span     token.Span
+	Message  string
+	// Fix is a suggestion for how to resolve the problem, empty if we
+	// don't have one.
+	Fix string
+}
+
+func (d Diagnostic) String() string {
+	if d.Span.IsValid() {
+		return fmt.Sprintf("%s: %s: %s", d.Span, d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s: %s", d.Severity, d.Message)
+}
+
+// Render writes d to out along with the offending line of source and a
+// caret underline, like so:
+//
+//	error[P001]: expected next token to be IDENT, got =
+//	 --> 3:5
+//	  |
+//	3 | ask = 15;
+//	  |     ^
+//	  = fix: ...
+func Render(out io.Writer, source string, d Diagnostic) {
+	fmt.Fprintf(out, "%s[%s]: %s\n", d.Severity, d.Code, d.Message)
+	if !d.Span.IsValid() {
+		if d.Fix != "" {
+			fmt.Fprintf(out, " = fix: %s\n", d.Fix)
+		}
+		return
+	}
+
+	lines := strings.Split(source, "\n")
+	lineNo := d.Span.Start.Line
+	gutter := strings.Repeat(" ", len(fmt.Sprint(lineNo)))
+
+	fmt.Fprintf(out, "%s--> %s\n", gutter, d.Span)
+	if lineNo > len(lines) {
+		return
+	}
+
+	line := strings.TrimRight(lines[lineNo-1], "\r")
+	fmt.Fprintf(out, "%s |\n", gutter)
+	fmt.Fprintf(out, "%d | %s\n", lineNo, line)
+	fmt.Fprintf(out, "%s | %s\n", gutter, underline(line, d.Span))
+	if d.Fix != "" {
+		fmt.Fprintf(out, "%s = fix: %s\n", gutter, d.Fix)
+	}
+}
+
+// underline builds the caret line for span on line, keeping tabs so the
+// carets stay lined up with the source above them. Columns count chars, so
+// we work in runes rather than bytes.
+func underline(line string, span token.Span) string {
+	chars := []rune(line)
+	start := span.Start.Column - 1
+	if start > len(chars) {
+		start = len(chars)
+	}
+
+	width := 1
+	if span.End.Line == span.Start.Line && span.End.Column > span.Start.Column {
+		width = span.End.Column - span.Start.Column
+	} else if span.End.Line > span.Start.Line && len(chars) > start {
+		width = len(chars) - start
+	}
+
+	var out strings.Builder
+	for _, char := range chars[:start] {
+		if char == '\t' {
+			out.WriteRune('\t')
+		} else {
+			out.WriteRune(' ')
+		}
+	}
+	out.WriteString(strings.Repeat("^", width))
+
+	return out.String()
+}
@@ -0,0 +1,113 @@
+package diagnostic
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Linkinlog/MagLang/token"
+)
+
+func TestDiagnostic_String(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		d    Diagnostic
+		want string
+	}{
+		{
+			name: "Test_String_WithSpan",
+			d: Diagnostic{
+				Severity: Error,
+				Code:     UnexpectedToken,
+				Span:     token.Span{Start: token.Position{Line: 3, Column: 5, Offset: 27}},
+				Message:  "expected next token to be IDENT, got =",
+			},
+			want: "3:5: error: expected next token to be IDENT, got =",
+		},
+		{
+			name: "Test_String_WithoutSpan",
+			d:    Diagnostic{Severity: Warning, Message: "careful now"},
+			want: "warning: careful now",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.d.String(); got != tt.want {
+				t.Errorf("Diagnostic.String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	t.Parallel()
+	source := "ask x = 5;\n\task y = (x + 1;\nask 名前 = );\n"
+	tests := []struct {
+		name string
+		d    Diagnostic
+		want string
+	}{
+		{
+			name: "Test_Render_Caret",
+			d: Diagnostic{
+				Severity: Error,
+				Code:     UnexpectedToken,
+				Span: token.Span{
+					Start: token.Position{Line: 2, Column: 16, Offset: 26},
+					End:   token.Position{Line: 2, Column: 17, Offset: 27},
+				},
+				Message: "expected next token to be ), got ;",
+				Fix:     "try adding `)` here",
+			},
+			want: "error[P001]: expected next token to be ), got ;\n" +
+				" --> 2:16\n" +
+				"  |\n" +
+				"2 | \task y = (x + 1;\n" +
+				"  | \t              ^\n" +
+				"  = fix: try adding `)` here\n",
+		},
+		{
+			name: "Test_Render_Underline",
+			d: Diagnostic{
+				Severity: Error,
+				Code:     NoPrefixParseFn,
+				Span: token.Span{
+					Start: token.Position{Line: 1, Column: 5, Offset: 4},
+					End:   token.Position{Line: 1, Column: 8, Offset: 7},
+				},
+				Message: "no prefix parse function for = found",
+			},
+			want: "error[P002]: no prefix parse function for = found\n" +
+				" --> 1:5\n" +
+				"  |\n" +
+				"1 | ask x = 5;\n" +
+				"  |     ^^^\n",
+		},
+		{
+			name: "Test_Render_Unicode",
+			d: Diagnostic{
+				Severity: Error,
+				Code:     NoPrefixParseFn,
+				Span: token.Span{
+					Start: token.Position{Line: 3, Column: 9, Offset: 40},
+					End:   token.Position{Line: 3, Column: 10, Offset: 41},
+				},
+				Message: "no prefix parse function for ) found",
+			},
+			want: "error[P002]: no prefix parse function for ) found\n" +
+				" --> 3:9\n" +
+				"  |\n" +
+				"3 | ask 名前 = );\n" +
+				"  |         ^\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			Render(&out, source, tt.d)
+			if got := out.String(); got != tt.want {
+				t.Errorf("Render() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
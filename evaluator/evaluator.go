@@ -1,17 +1,24 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/Linkinlog/MagLang/ast"
 	"github.com/Linkinlog/MagLang/object"
+	"github.com/Linkinlog/MagLang/token"
 )
 
 var (
 	TRUE  = &object.Boolean{Value: true}
 	FALSE = &object.Boolean{Value: false}
 	NULL  = &object.Null{}
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
 func isError(obj object.Object) bool {
@@ -21,45 +28,174 @@ func isError(obj object.Object) bool {
 	return false
 }
 
+// isAbrupt reports whether obj cuts evaluation short: an error, or an
+// enough, anyway or giving on its way out to the loop or funk it's meant
+// for. Expressions hand these straight back instead of using them as values.
+func isAbrupt(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Error, *object.Break, *object.Continue, *object.ReturnValue:
+		return true
+	}
+	return false
+}
+
+// DefaultMaxCallDepth is how deeply funk calls may nest when Options
+// doesn't say. Each level takes several KB of Go stack, so this keeps well
+// clear of the runtime's limit.
+const DefaultMaxCallDepth = 10000
+
+// Options tweaks how programs are evaluated. The zero value gives the
+// default behaviour.
+type Options struct {
+	// CheckedArithmetic makes integer +, - and * report an error on overflow
+	// instead of silently wrapping around.
+	CheckedArithmetic bool
+	// Limits caps the steps and allocations a program may use, see Limits.
+	Limits Limits
+	// MaxCallDepth caps how deeply funk calls may nest before the call
+	// fails with an error, instead of crashing the process with a Go stack
+	// overflow. Tail calls don't nest, so they don't count, which leaves
+	// tail recursion like `funk(n) { f(n + 1) }` free to run forever. Only
+	// EvalContext or Limits stop that. Zero means DefaultMaxCallDepth.
+	MaxCallDepth int
+}
+
+// Evaluator evaluates programs using a set of Options. It is not safe for
+// concurrent use.
+type Evaluator struct {
+	opts Options
+	// ctx is checked as evaluation goes so it can be called off, see
+	// EvalContext.
+	ctx context.Context
+	// stack is the funk calls in progress, outermost first.
+	stack []object.Frame
+	// depth is how many calls are nested on the Go stack, which is less
+	// than len(stack) when some were tail calls.
+	depth int
+	// tailCalls holds the calls in tail position of every funk body in
+	// scanned, see tailCalls.
+	tailCalls tailCalls
+	scanned   map[*ast.BlockStatement]bool
+	usage     Usage
+}
+
+func New(opts Options) *Evaluator {
+	if opts.MaxCallDepth == 0 {
+		opts.MaxCallDepth = DefaultMaxCallDepth
+	}
+	return &Evaluator{opts: opts, ctx: context.Background(), tailCalls: make(tailCalls), scanned: make(map[*ast.BlockStatement]bool)}
+}
+
+// Eval evaluates node with the default Options.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return New(Options{}).Eval(node, env)
+}
+
+// EvalContext evaluates node with the default Options until ctx is done,
+// see Evaluator.EvalContext.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	return New(Options{}).EvalContext(ctx, node, env)
+}
+
+// EvalContext is like Eval, but gives up with an error once ctx is done.
+// The context is checked on entering every block and funk call, which any
+// loop or recursion has to do, and the error's Cause is ctx.Err(). Scripts
+// can't catch it with attempt.
+func (e *Evaluator) EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	outer := e.ctx
+	e.ctx = ctx
+	defer func() { e.ctx = outer }()
+
+	return e.Eval(node, env)
+}
+
+func (e *Evaluator) Eval(node ast.Node, env *object.Environment) object.Object {
+	result := e.eval(node, env)
+	if result == nil {
+		// Asks and empty blocks have no value of their own. Treat that as
+		// null, as the vm does, so it's safe to put anywhere a value goes.
+		return NULL
+	}
+
+	// The innermost node an error comes out of is the most precise spot we
+	// can point at, so only fill in the span if nobody has yet. The call
+	// stack is still as deep as it got at that point too.
+	if err, ok := result.(*object.Error); ok && !err.Span.IsValid() {
+		err.Span = node.Span()
+		err.Stack = e.traceback()
+	}
+
+	return result
+}
+
+func (e *Evaluator) eval(node ast.Node, env *object.Environment) object.Object {
+	if err := e.step(); err != nil {
+		return err
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
-		return evalProgram(node, env)
+		return e.evalProgram(node, env)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return e.Eval(node.Expression, env)
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.Boolean:
 		return evalBool(node.Value)
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
-		if isError(right) {
+		right := e.Eval(node.Right, env)
+		if isAbrupt(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
+		if node.Operator == "&&" || node.Operator == "||" {
+			return e.evalLogicalExpression(node, env)
+		}
+		left := e.Eval(node.Left, env)
+		if isAbrupt(left) {
 			return left
 		}
-		right := Eval(node.Right, env)
-		if isError(right) {
+		right := e.Eval(node.Right, env)
+		if isAbrupt(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return e.evalInfixExpression(node.Operator, left, right)
+	case *ast.MatchExpression:
+		return e.evalMatchExpression(node, env)
+	case *ast.TryExpression:
+		return e.evalTryExpression(node, env)
+	case *ast.ThrowStatement:
+		val := e.Eval(node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		return thrownError(val)
+	case *ast.WhileStatement:
+		return e.evalWhileStatement(node, env)
+	case *ast.ForInStatement:
+		return e.evalForInStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
+	case *ast.AssignExpression:
+		return e.evalAssignExpression(node, env)
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return e.evalBlockStatement(node, env)
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return e.evalIfExpression(node, env)
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
-		if isError(val) {
+		val := e.Eval(node.ReturnValue, env)
+		if isAbrupt(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 	case *ast.AskStatement:
-		val := Eval(node.Value, env)
-		if isError(val) {
+		val := e.Eval(node.Value, env)
+		if isAbrupt(val) {
 			return val
 		}
 		env.Set(node.Name.Value, val)
@@ -68,63 +204,220 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Body: body, Env: env}
+		return &object.Function{Parameters: params, Defaults: node.Defaults, Rest: node.Rest, Body: body, Env: env, Name: node.Name}
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
-		if isError(function) {
+		function := e.Eval(node.Function, env)
+		if isAbrupt(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
+		args := e.evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isAbrupt(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		if fn, ok := function.(*object.Function); ok && e.tailCalls[node] {
+			return &object.TailCall{Function: fn, Arguments: args, CallSite: node.Span()}
+		}
+		return e.applyFunction(function, args, node.Span())
+	case *ast.SpreadExpression:
+		// evalExpressions does the actual spreading, we just make sure
+		// there's an array to spread.
+		val := e.Eval(node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		if val.Type() != object.ARRAY_OBJ {
+			return newError("cannot spread %s, only ARRAY", val.Type())
+		}
+		return val
 	case *ast.StringLiteral:
-		return &object.String{Value: node.Value}
+		return e.track(&object.String{Value: node.Value})
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env)
-		if len(elements) == 1 && isError(elements[0]) {
+		elements := e.evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isAbrupt(elements[0]) {
 			return elements[0]
 		}
-		return &object.Array{Elements: elements}
+		return e.track(&object.Array{Elements: elements})
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
+		left := e.Eval(node.Left, env)
+		if isAbrupt(left) {
 			return left
 		}
-		index := Eval(node.Index, env)
-		if isError(index) {
+		index := e.Eval(node.Index, env)
+		if isAbrupt(index) {
 			return index
 		}
 		return evalIndexExpression(left, index)
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return e.evalHashLiteral(node, env)
 	}
 
 	return nil
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+func (e *Evaluator) applyFunction(fn object.Object, args []object.Object, callSite token.Span) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		if e.depth >= e.opts.MaxCallDepth {
+			return newError("maximum recursion depth exceeded in `%s`", functionName(fn))
+		}
+		if err := e.checkCall(fn, args); err != nil {
+			return err
+		}
+		e.depth++
+
+		// Tail calls come back to us to make, so they run in this loop
+		// instead of deeper on the Go stack. The call that started the
+		// chain keeps its frame, but each tail call after it takes the
+		// frame of the one before and only counts it, so a chain of any
+		// length needs two frames.
+		frames := len(e.stack)
+		e.stack = append(e.stack, object.Frame{Function: functionName(fn), CallSite: callSite})
+		result := e.callFunction(fn, args)
+		for tailCalls := 0; ; tailCalls++ {
+			tailCall, ok := result.(*object.TailCall)
+			if !ok {
+				break
+			}
+			// The call hasn't been made yet, so the frame making it is
+			// still the one to blame.
+			if err := e.checkCall(tailCall.Function, tailCall.Arguments); err != nil {
+				err.Span = tailCall.CallSite
+				err.Stack = e.traceback()
+				result = err
+				break
+			}
+			e.stack = append(e.stack[:frames+1], object.Frame{
+				Function:  functionName(tailCall.Function),
+				CallSite:  tailCall.CallSite,
+				TailCalls: tailCalls,
+			})
+			result = e.callFunction(tailCall.Function, tailCall.Arguments)
+		}
+		e.stack = e.stack[:frames]
+		e.depth--
+
+		return result
 	case *object.Builtin:
-		return fn.Fn(args...)
+		if result := fn.Fn(args...); result != nil {
+			return e.track(result)
+		}
+		return NULL
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+// checkCall returns an error if fn can't be called with args, which is
+// the caller's fault, or if evaluation has been called off.
+func (e *Evaluator) checkCall(fn *object.Function, args []object.Object) *object.Error {
+	required := len(fn.Parameters) - len(fn.Defaults)
+	if len(args) < required || len(args) > len(fn.Parameters) && fn.Rest == nil {
+		return arityError(fn, len(args))
+	}
+	return e.cancelled()
+}
+
+// callFunction evaluates fn's body with args bound, once checkCall is
+// happy with them. applyFunction pushes its frame first, since defaults are
+// evaluated inside the call too. The result is a TailCall if the body ended
+// in one.
+func (e *Evaluator) callFunction(fn *object.Function, args []object.Object) object.Object {
+	extendedEnv, err := e.extendFunctionEnv(fn, args)
+	if err != nil {
+		return err
+	}
+
+	if !e.scanned[fn.Body] {
+		e.tailCalls.scanBlock(fn.Body, true)
+		e.scanned[fn.Body] = true
+	}
+
+	return unwrapReturnValue(e.Eval(fn.Body, extendedEnv))
+}
+
+// cancelled returns an error if the context evaluation runs under is done.
+func (e *Evaluator) cancelled() *object.Error {
+	return Cancelled(e.ctx)
+}
+
+// Cancelled returns the error evaluation gives up with once ctx is done,
+// or nil if it isn't. Its Cause is ctx.Err().
+func Cancelled(ctx context.Context) *object.Error {
+	select {
+	case <-ctx.Done():
+		return &object.Error{Message: "evaluation cancelled: " + ctx.Err().Error(), Cause: ctx.Err()}
+	default:
+		return nil
+	}
+}
+
+// extendFunctionEnv binds args to fn's parameters in a new environment.
+// Parameters left without an argument get their default, which is evaluated
+// in the new environment so it can refer to the parameters before it.
+func (e *Evaluator) extendFunctionEnv(fn *object.Function, args []object.Object) (*object.Environment, *object.Error) {
 	env := object.NewEnclosedEnvironment(fn.Env)
 
+	if fn.Rest != nil {
+		rest := []object.Object{}
+		if len(args) > len(fn.Parameters) {
+			rest = append(rest, args[len(fn.Parameters):]...)
+		}
+		if err := e.allocate(int64(len(rest))); err != nil {
+			return nil, err
+		}
+		env.Set(fn.Rest.Value, &object.Array{Elements: rest})
+	}
+
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		if paramIdx < len(args) {
+			env.Set(param.Value, args[paramIdx])
+			continue
+		}
+		value := e.Eval(fn.Defaults[param.Value], env)
+		if err, ok := value.(*object.Error); ok {
+			return nil, err
+		}
+		env.Set(param.Value, value)
 	}
 
-	return env
+	return env, nil
+}
+
+// traceback copies the call stack, innermost call first.
+func (e *Evaluator) traceback() []object.Frame {
+	if len(e.stack) == 0 {
+		return nil
+	}
+
+	frames := make([]object.Frame, len(e.stack))
+	for i, frame := range e.stack {
+		frames[len(frames)-1-i] = frame
+	}
+
+	return frames
+}
+
+// functionName is what to call fn in messages, falling back to "funk" for
+// functions that were never bound to a name.
+func functionName(fn *object.Function) string {
+	if fn.Name == "" {
+		return "funk"
+	}
+	return fn.Name
+}
+
+func arityError(fn *object.Function, got int) *object.Error {
+	name := functionName(fn)
+
+	want := fmt.Sprint(len(fn.Parameters))
+	switch {
+	case fn.Rest != nil:
+		want = fmt.Sprintf("%d or more", len(fn.Parameters)-len(fn.Defaults))
+	case len(fn.Defaults) > 0:
+		want = fmt.Sprintf("%d..%d", len(fn.Parameters)-len(fn.Defaults), len(fn.Parameters))
+	}
+
+	return newError("wrong number of arguments to `%s`. got=%d, want=%s", name, got, want)
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
@@ -135,15 +428,20 @@ func unwrapReturnValue(obj object.Object) object.Object {
 	return obj
 }
 
-func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+func (e *Evaluator) evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 
-	for _, e := range exps {
-		evaluated := Eval(e, env)
-		if isError(evaluated) {
+	for _, exp := range exps {
+		evaluated := e.Eval(exp, env)
+		if isAbrupt(evaluated) {
 			return []object.Object{evaluated}
 		}
 
+		if _, ok := exp.(*ast.SpreadExpression); ok {
+			result = append(result, evaluated.(*object.Array).Elements...)
+			continue
+		}
+
 		result = append(result, evaluated)
 	}
 
@@ -155,27 +453,321 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin := object.GetBuiltinByName(node.Value); builtin != nil {
 		return builtin
 	}
 
 	return newError("identifier not found: " + node.Value)
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
-	if isError(condition) {
+// evalTryExpression evaluates the body, falling back to the handler if the
+// body fails. The handler sees the error as a hash, see errorToHash.
+func (e *Evaluator) evalTryExpression(node *ast.TryExpression, env *object.Environment) object.Object {
+	result := e.Eval(node.Body, env)
+
+	// Errors with a Cause aren't the script's doing, so they're not its to
+	// catch either.
+	err, ok := result.(*object.Error)
+	if !ok || err.Cause != nil {
+		return result
+	}
+
+	handlerEnv := object.NewEnclosedEnvironment(env)
+	if node.Param != nil {
+		handlerEnv.Set(node.Param.Value, errorToHash(err))
+	}
+
+	return e.Eval(node.Handler, handlerEnv)
+}
+
+// errorToHash turns a caught error into a value scripts can inspect, with a
+// "message" and, when we know where it happened, a "line" and "column".
+func errorToHash(err *object.Error) *object.Hash {
+	hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair)}
+	set := func(key string, value object.Object) {
+		k := &object.String{Value: key}
+		hash.Pairs[k.HashKey()] = object.HashPair{Key: k, Value: value}
+	}
+
+	set("message", &object.String{Value: err.Message})
+	if err.Span.IsValid() {
+		set("line", &object.Integer{Value: int64(err.Span.Start.Line)})
+		set("column", &object.Integer{Value: int64(err.Span.Start.Column)})
+	}
+
+	return hash
+}
+
+// thrownError builds the error for `yeet val`. A string is used as the
+// message, and a hash with a "message", like the one fetch hands out, is
+// thrown again with that message. Anything else is yeeted as it prints.
+func thrownError(val object.Object) *object.Error {
+	switch val := val.(type) {
+	case *object.String:
+		return newError("%s", val.Value)
+	case *object.Hash:
+		key := &object.String{Value: "message"}
+		if pair, ok := val.Pairs[key.HashKey()]; ok {
+			if message, ok := pair.Value.(*object.String); ok {
+				return newError("%s", message.Value)
+			}
+		}
+	}
+	return newError("%s", val.Inspect())
+}
+
+func (e *Evaluator) evalWhileStatement(node *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := e.Eval(node.Condition, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		if result, stop := e.evalLoopBody(node.Body, env); stop {
+			return result
+		}
+	}
+}
+
+func (e *Evaluator) evalForInStatement(node *ast.ForInStatement, env *object.Environment) object.Object {
+	iterable := e.Eval(node.Iterable, env)
+	if isAbrupt(iterable) {
+		return iterable
+	}
+
+	next, ok := iterate(iterable, node.Key != nil)
+	if !ok {
+		return newError("cannot peruse %s", iterable.Type())
+	}
+
+	for key, value, ok := next(); ok; key, value, ok = next() {
+		if node.Key != nil {
+			env.Set(node.Key.Value, key)
+		}
+		env.Set(node.Value.Value, value)
+		if result, stop := e.evalLoopBody(node.Body, env); stop {
+			return result
+		}
+	}
+
+	return NULL
+}
+
+// iterate returns a function giving each key and value peruse visits in
+// iterable, in order, until it reports there are no more. Arrays and
+// strings are keyed by position. A hash gives its keys as the values too,
+// unless keyed, when the loop asked for both.
+func iterate(iterable object.Object, keyed bool) (func() (key, value object.Object, ok bool), bool) {
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		elements := iterable.Elements
+		i := 0
+		return func() (object.Object, object.Object, bool) {
+			if i >= len(elements) {
+				return nil, nil, false
+			}
+			i++
+			return &object.Integer{Value: int64(i - 1)}, elements[i-1], true
+		}, true
+	case *object.String:
+		s := iterable.Value
+		offset, i := 0, int64(0)
+		return func() (object.Object, object.Object, bool) {
+			if offset >= len(s) {
+				return nil, nil, false
+			}
+			char, width := utf8.DecodeRuneInString(s[offset:])
+			offset += width
+			i++
+			return &object.Integer{Value: i - 1}, &object.String{Value: string(char)}, true
+		}, true
+	case *object.Hash:
+		pairs := iterable.SortedPairs()
+		i := 0
+		return func() (object.Object, object.Object, bool) {
+			if i >= len(pairs) {
+				return nil, nil, false
+			}
+			pair := pairs[i]
+			i++
+			if !keyed {
+				return pair.Key, pair.Key, true
+			}
+			return pair.Key, pair.Value, true
+		}, true
+	case *object.Range:
+		r := iterable
+		n, more, i := r.Start, r.Contains(r.Start), int64(0)
+		return func() (object.Object, object.Object, bool) {
+			if !more {
+				return nil, nil, false
+			}
+			key, value := &object.Integer{Value: i}, &object.Integer{Value: n}
+			i++
+			n, more = r.Next(n)
+			return key, value, true
+		}, true
+	}
+
+	return nil, false
+}
+
+// evalLoopBody runs one iteration of a loop. It reports whether the loop
+// should stop, along with what the loop evaluates to if so.
+func (e *Evaluator) evalLoopBody(body *ast.BlockStatement, env *object.Environment) (object.Object, bool) {
+	switch result := e.Eval(body, env).(type) {
+	case *object.Break:
+		return NULL, true
+	case *object.ReturnValue, *object.Error:
+		return result, true
+	}
+	return nil, false
+}
+
+func (e *Evaluator) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := e.Eval(ie.Condition, env)
+	if isAbrupt(condition) {
 		return condition
 	}
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return e.Eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return e.Eval(ie.Alternative, env)
 	} else {
 		return NULL
 	}
 }
 
+// evalAssignExpression updates the binding or element named by the target.
+// A compound operator like += applies its arithmetic to the current value
+// first.
+func (e *Evaluator) evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	if target, ok := node.Target.(*ast.IndexExpression); ok {
+		return e.evalIndexAssignment(node, target, env)
+	}
+
+	name := node.Target.(*ast.Identifier).Value
+
+	val := e.Eval(node.Value, env)
+	if isAbrupt(val) {
+		return val
+	}
+
+	if node.Operator != "=" {
+		current, ok := env.Get(name)
+		if !ok {
+			return newError("cannot assign to undeclared identifier: %s", name)
+		}
+		val = e.evalCompoundAssignment(node.Operator, current, val)
+		if isError(val) {
+			return val
+		}
+	}
+
+	if _, ok := env.Assign(name, val); !ok {
+		return newError("cannot assign to undeclared identifier: %s", name)
+	}
+
+	return val
+}
+
+// evalIndexAssignment handles `arr[i] = v` and `h["k"] = v`, updating the
+// array or hash in place.
+func (e *Evaluator) evalIndexAssignment(node *ast.AssignExpression, target *ast.IndexExpression, env *object.Environment) object.Object {
+	left := e.Eval(target.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+	index := e.Eval(target.Index, env)
+	if isAbrupt(index) {
+		return index
+	}
+	val := e.Eval(node.Value, env)
+	if isAbrupt(val) {
+		return val
+	}
+
+	return e.assignIndex(node.Operator, left, index, val)
+}
+
+// assignIndex stores val at index in left, combining it with the current
+// value first for an operator like +=.
+func (e *Evaluator) assignIndex(operator string, left, index, val object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		idx, ok := index.(*object.Integer)
+		if !ok {
+			return newError("array index must be INTEGER, got %s", index.Type())
+		}
+		if idx.Value < 0 || idx.Value >= int64(len(left.Elements)) {
+			return newError("index out of range: %d with length %d", idx.Value, len(left.Elements))
+		}
+		if operator != "=" {
+			val = e.evalCompoundAssignment(operator, left.Elements[idx.Value], val)
+			if isError(val) {
+				return val
+			}
+		}
+		left.Elements[idx.Value] = val
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		if operator != "=" {
+			pair, ok := left.Pairs[key.HashKey()]
+			if !ok {
+				return newError("key not found: %s", index.Inspect())
+			}
+			val = e.evalCompoundAssignment(operator, pair.Value, val)
+			if isError(val) {
+				return val
+			}
+		}
+		if _, ok := left.Pairs[key.HashKey()]; !ok {
+			if err := e.allocate(1); err != nil {
+				return err
+			}
+		}
+		left.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: val}
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+
+	return val
+}
+
+// evalCompoundAssignment works out the new value for an operator like +=.
+func (e *Evaluator) evalCompoundAssignment(operator string, current, val object.Object) object.Object {
+	return e.evalInfixExpression(strings.TrimSuffix(operator, "="), current, val)
+}
+
+// evalLogicalExpression evaluates && and ||, only evaluating the right side
+// when the left side doesn't already decide the answer.
+func (e *Evaluator) evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := e.Eval(node.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+
+	if node.Operator == "&&" && !isTruthy(left) {
+		return FALSE
+	}
+	if node.Operator == "||" && isTruthy(left) {
+		return TRUE
+	}
+
+	right := e.Eval(node.Right, env)
+	if isAbrupt(right) {
+		return right
+	}
+
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case NULL:
@@ -199,11 +791,11 @@ func evalBool(v string) *object.Boolean {
 	return nil
 }
 
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+func (e *Evaluator) evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		result = e.Eval(statement, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
@@ -216,15 +808,20 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	return result
 }
 
-func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+func (e *Evaluator) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	if err := e.cancelled(); err != nil {
+		return err
+	}
+
 	var result object.Object
 
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		result = e.Eval(statement, env)
 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ ||
+				rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				return result
 			}
 		}
@@ -268,20 +865,24 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
-
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
 }
 
-func evalInfixExpression(operator string, left, right object.Object) object.Object {
+func (e *Evaluator) evalInfixExpression(operator string, left, right object.Object) object.Object {
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
-		return evalIntegerInfixExpression(operator, left, right)
+		return e.evalIntegerInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-		return evalStringInfixExpression(operator, left, right)
+		return e.track(evalStringInfixExpression(operator, left, right))
 	case operator == "==":
 		return nativeBoolToBooleanObject(left == right)
 	case operator == "!=":
@@ -307,23 +908,86 @@ func evalStringInfixExpression(operator string, left, right object.Object) objec
 	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 }
 
-func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+func (e *Evaluator) evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
 	leftValue := left.(*object.Integer).Value
 	rightValue := right.(*object.Integer).Value
 
+	switch operator {
+	case "+", "-", "*":
+		result, overflowed := integerArithmetic(operator, leftValue, rightValue)
+		if overflowed && e.opts.CheckedArithmetic {
+			return newError("integer overflow: %d %s %d", leftValue, operator, rightValue)
+		}
+		return &object.Integer{Value: result}
+	case "/":
+		if rightValue == 0 {
+			return newError("division by zero: %d / %d", leftValue, rightValue)
+		}
+		return &object.Integer{Value: leftValue / rightValue}
+	case "%":
+		if rightValue == 0 {
+			return newError("division by zero: %d %% %d", leftValue, rightValue)
+		}
+		return &object.Integer{Value: leftValue % rightValue}
+	case "<":
+		return nativeBoolToBooleanObject(leftValue < rightValue)
+	case ">":
+		return nativeBoolToBooleanObject(leftValue > rightValue)
+	case "<=":
+		return nativeBoolToBooleanObject(leftValue <= rightValue)
+	case ">=":
+		return nativeBoolToBooleanObject(leftValue >= rightValue)
+	case "==":
+		return nativeBoolToBooleanObject(leftValue == rightValue)
+	case "!=":
+		return nativeBoolToBooleanObject(leftValue != rightValue)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// integerArithmetic applies +, - or * to left and right, wrapping around
+// like Go does, and reports whether the result overflowed int64.
+func integerArithmetic(operator string, left, right int64) (result int64, overflowed bool) {
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftValue + rightValue}
+		result = left + right
+		overflowed = (right > 0 && result < left) || (right < 0 && result > left)
 	case "-":
-		return &object.Integer{Value: leftValue - rightValue}
+		result = left - right
+		overflowed = (right < 0 && result < left) || (right > 0 && result > left)
 	case "*":
-		return &object.Integer{Value: leftValue * rightValue}
+		result = left * right
+		overflowed = left != 0 && (result/left != right || (left == -1 && right == math.MinInt64))
+	}
+	return result, overflowed
+}
+
+// evalFloatInfixExpression handles arithmetic where at least one side is a
+// float, promoting an integer on the other side.
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftValue := toFloat(left)
+	rightValue := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftValue + rightValue}
+	case "-":
+		return &object.Float{Value: leftValue - rightValue}
+	case "*":
+		return &object.Float{Value: leftValue * rightValue}
 	case "/":
-		return &object.Integer{Value: leftValue / rightValue}
+		return &object.Float{Value: leftValue / rightValue}
+	case "%":
+		return &object.Float{Value: math.Mod(leftValue, rightValue)}
 	case "<":
 		return nativeBoolToBooleanObject(leftValue < rightValue)
 	case ">":
 		return nativeBoolToBooleanObject(leftValue > rightValue)
+	case "<=":
+		return nativeBoolToBooleanObject(leftValue <= rightValue)
+	case ">=":
+		return nativeBoolToBooleanObject(leftValue >= rightValue)
 	case "==":
 		return nativeBoolToBooleanObject(leftValue == rightValue)
 	case "!=":
@@ -333,6 +997,22 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	}
 }
 
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// toFloat widens an Integer or Float to a float64. Callers check isNumber
+// first.
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.Float:
+		return obj.Value
+	}
+	return 0
+}
+
 func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
@@ -356,12 +1036,12 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	return arrayObject.Elements[idx]
 }
 
-func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+func (e *Evaluator) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
 
 	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
-		if isError(key) {
+		key := e.Eval(keyNode, env)
+		if isAbrupt(key) {
 			return key
 		}
 
@@ -370,8 +1050,8 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 			return newError("unusable as hash key: %s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
-		if isError(value) {
+		value := e.Eval(valueNode, env)
+		if isAbrupt(value) {
 			return value
 		}
 
@@ -379,7 +1059,7 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 		pairs[hashed] = object.HashPair{Key: key, Value: value}
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return e.track(&object.Hash{Pairs: pairs})
 }
 
 func evalHashIndexExpression(hash, index object.Object) object.Object {
@@ -1,11 +1,19 @@
-package evaluator
+package evaluator_test
 
 import (
+	"context"
+	"errors"
+	"math"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/Linkinlog/MagLang/compiler"
+	"github.com/Linkinlog/MagLang/evaluator"
 	"github.com/Linkinlog/MagLang/lexer"
 	"github.com/Linkinlog/MagLang/object"
 	"github.com/Linkinlog/MagLang/parser"
+	"github.com/Linkinlog/MagLang/vm"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -29,23 +37,128 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 + 10 % 4 * 3", 8},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.input, func(t *testing.T) {
-			evaluated := testEval(tt.input)
+			evaluated := testEval(t, tt.input)
 			testIntegerObject(t, evaluated, tt.expected)
 		})
 	}
 }
 
-func testEval(input string) object.Object {
-	l := lexer.New(input)
-	p := parser.New(l)
-	program := p.ParseProgram()
-	env := object.NewEnvironment()
+func TestEvalFloatExpression(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"1.5", 1.5},
+		{"-2.25", -2.25},
+		{"1.5e3", 1500},
+		{"0.1 + 0.2 * 10", 2.1},
+		{"1.5 + 1", 2.5},
+		{"1 + 1.5", 2.5},
+		{"7 / 2.0", 3.5},
+		{"(1 + 2 + 3) / 4.0", 1.5},
+		{"2.5 * -2", -5},
+		{"10 - 0.5", 9.5},
+		{"7.5 % 2", 1.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(t, tt.input)
+			testFloatObject(t, evaluated, tt.expected)
+		})
+	}
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if math.Abs(result.Value-expected) > 1e-9 {
+		t.Errorf("object has wrong value. got=%g, want=%g",
+			result.Value, expected)
+		return false
+	}
+	return true
+}
+
+// testEval evaluates input and checks that compiling it and running it on
+// the vm comes out the same, so every case here covers both backends.
+func testEval(t *testing.T, input string) object.Object {
+	t.Helper()
+	return testEvalWith(t, evaluator.Options{}, input)
+}
+
+// testEvalWith is testEval with opts, which the vm is given the
+// equivalent of.
+func testEvalWith(t *testing.T, opts evaluator.Options, input string) object.Object {
+	t.Helper()
+	evaluated := runEvaluator(t, context.Background(), opts, input)
+	ran := runVM(t, context.Background(), opts, input)
+
+	if want, got := describe(evaluated), describe(ran); want != got {
+		t.Errorf("the vm disagrees with the evaluator.\nevaluator=%s\nvm=       %s", want, got)
+	}
+	return evaluated
+}
+
+// backends are the ways to run a program, for tests that have to check
+// each on its own because the results depend on timing.
+var backends = map[string]func(t *testing.T, ctx context.Context, opts evaluator.Options, input string) object.Object{
+	"evaluator": runEvaluator,
+	"vm":        runVM,
+}
 
-	return Eval(program, env)
+func runEvaluator(t *testing.T, ctx context.Context, opts evaluator.Options, input string) object.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	return evaluator.New(opts).EvalContext(ctx, program, object.NewEnvironment())
+}
+
+// runVM compiles input and runs it on the vm, returning what it evaluated
+// to or the error it failed with. The vm has no Limits, so they're ignored.
+func runVM(t *testing.T, ctx context.Context, opts evaluator.Options, input string) object.Object {
+	t.Helper()
+	program := parser.New(lexer.New(input)).ParseProgram()
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := vm.New(comp.Bytecode(), vm.Options{
+		CheckedArithmetic: opts.CheckedArithmetic,
+		MaxCallDepth:      opts.MaxCallDepth,
+	})
+	if err := machine.RunContext(ctx); err != nil {
+		return err.(*object.Error)
+	}
+	return machine.LastPoppedStackElem()
+}
+
+// describe renders a result so the backends can be compared. Functions
+// compile to closures, so only their type is compared.
+func describe(obj object.Object) string {
+	switch obj := obj.(type) {
+	case nil:
+		return "a Go nil"
+	case *object.Null:
+		if obj != evaluator.NULL {
+			return "a null other than NULL"
+		}
+	case *object.Error:
+		return obj.Traceback()
+	case *object.Function, *object.Closure:
+		return string(obj.Type())
+	}
+	return obj.Inspect()
 }
 
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
@@ -86,11 +199,32 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(5 < 10) == cap", false},
 		{"(5 > 10) == fact", false},
 		{"(5 > 10) == cap", true},
+		{"1.5 < 2", true},
+		{"2 > 1.5", true},
+		{"1.0 == 1", true},
+		{"1.5 != 1.5", false},
+		{"0.5 > 0.25", true},
+		{"5 <= 5", true},
+		{"5 <= 4", false},
+		{"5 >= 5", true},
+		{"4 >= 5", false},
+		{"1.5 <= 2", true},
+		{"2 >= 2.5", false},
+		{"fact && fact", true},
+		{"fact && cap", false},
+		{"cap || fact", true},
+		{"cap || cap", false},
+		{"1 && \"yes\"", true},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
+		{"cap && missing", false},
+		{"fact || missing", true},
+		{"cap && missing()", false},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.input, func(t *testing.T) {
-			evaluated := testEval(tt.input)
+			evaluated := testEval(t, tt.input)
 			testBooleanObject(t, evaluated, tt.expected)
 		})
 	}
@@ -128,7 +262,7 @@ func TestBangOperator(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.input, func(t *testing.T) {
-			evaluated := testEval(tt.input)
+			evaluated := testEval(t, tt.input)
 			testBooleanObject(t, evaluated, tt.expected)
 		})
 	}
@@ -148,11 +282,18 @@ func TestIfElseExpressions(t *testing.T) {
 		{"consider (5 < 10) { 10 } however { 20 }", 10},
 		{"consider (fact) { 10 } however { 20 }", 10},
 		{"consider (cap) { 10 } however { 20 }", 20},
+		{"consider (cap) { 10 } however consider (fact) { 20 } however { 30 }", 20},
+		{"consider (cap) { 10 } however consider (cap) { 20 } however { 30 }", 30},
+		{"consider (cap) { 10 } however consider (cap) { 20 }", nil},
+		{"consider (fact) {}", nil},
+		{"ask x = 5", nil},
+		{"", nil},
+		{"ask x = 3; consider (x == 1) { 10 } however consider (x == 2) { 20 } however consider (x == 3) { 30 }", 30},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.input, func(t *testing.T) {
-			evaluated := testEval(tt.input)
+			evaluated := testEval(t, tt.input)
 			integer, ok := tt.expected.(int)
 			if ok {
 				testIntegerObject(t, evaluated, int64(integer))
@@ -164,7 +305,7 @@ func TestIfElseExpressions(t *testing.T) {
 }
 
 func testNullObject(t *testing.T, obj object.Object) bool {
-	if obj != NULL {
+	if obj != evaluator.NULL {
 		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
 		return false
 	}
@@ -209,7 +350,7 @@ consider (10 > 1) {
 
 	for _, tt := range tests {
 		t.Run(tt.input, func(t *testing.T) {
-			evaluated := testEval(tt.input)
+			evaluated := testEval(t, tt.input)
 			testIntegerObject(t, evaluated, tt.expected)
 		})
 	}
@@ -241,11 +382,54 @@ giving 1;
 		},
 		{"foo", "identifier not found: foo"},
 		{"\"hello\" - \"world\"", "unknown operator: STRING - STRING"},
+		{"1.5 + fact", "type mismatch: FLOAT + BOOLEAN"},
+		{"-\"a\"", "unknown operator: -STRING"},
+		{"5 % 0", "division by zero: 5 % 0"},
+		{"5 / 0", "division by zero: 5 / 0"},
+		{"ask zero = 0; 10 / (zero * 2)", "division by zero: 10 / 0"},
+		{"fact && missing", "identifier not found: missing"},
+		{"cap || missing", "identifier not found: missing"},
+		{"missing && fact", "identifier not found: missing"},
+		{"ask add = funk(x, y) { x + y; }; add(1);", "wrong number of arguments to `add`. got=1, want=2"},
+		{"ask add = funk(x, y) { x + y; }; add(1, 2, 3);", "wrong number of arguments to `add`. got=3, want=2"},
+		{"ask add = funk(x, y = 1) { x + y; }; add();", "wrong number of arguments to `add`. got=0, want=1..2"},
+		{"funk(x) { x; }()", "wrong number of arguments to `funk`. got=0, want=1"},
+		{"ask f = funk(x = missing) { x; }; f();", "identifier not found: missing"},
+		{"ask f = funk(x, ...rest) { x; }; f();", "wrong number of arguments to `f`. got=0, want=1 or more"},
+		{"ask f = funk(x) { x; }; f(...5);", "cannot spread INTEGER, only ARRAY"},
+		{"[1, ...missing]", "identifier not found: missing"},
+		{"x = 1", "cannot assign to undeclared identifier: x"},
+		{"x += 1", "cannot assign to undeclared identifier: x"},
+		{"ask f = funk() { y = 1; }; f();", "cannot assign to undeclared identifier: y"},
+		{"ask x = 1; x /= 0", "division by zero: 1 / 0"},
+		{"ask x = fact; x += 1", "type mismatch: BOOLEAN + INTEGER"},
+		{"ask xs = [1, 2]; xs[2] = 3", "index out of range: 2 with length 2"},
+		{"ask xs = [1, 2]; xs[-1] = 3", "index out of range: -1 with length 2"},
+		{`ask xs = [1, 2]; xs["a"] = 3`, "array index must be INTEGER, got STRING"},
+		{`ask h = {}; h[funk(x) { x }] = 1`, "unusable as hash key: FUNCTION"},
+		{`ask h = {}; h["a"] += 1`, "key not found: a"},
+		{`ask s = "abc"; s[0] = "z"`, "index assignment not supported: STRING"},
+		{"missing[0] = 1", "identifier not found: missing"},
+		{"whilst (missing) { 1 }", "identifier not found: missing"},
+		{"whilst (fact) { missing }", "identifier not found: missing"},
+		{"peruse (x in 5) { x }", "cannot peruse INTEGER"},
+		{"peruse (x in missing) { x }", "identifier not found: missing"},
+		{"peruse (x in [1]) { missing }", "identifier not found: missing"},
+		{`sniff (3) { 1 => "one", 2 => "two" }`, "no sniff arm matched 3"},
+		{`sniff (3) { n consider (n > 5) => n }`, "no sniff arm matched 3"},
+		{`sniff (missing) { _ => 1 }`, "identifier not found: missing"},
+		{`sniff (1) { n consider (missing) => 1 }`, "identifier not found: missing"},
+		{`sniff (1) { _ => missing }`, "identifier not found: missing"},
+		{`yeet "boom"`, "boom"},
+		{`error("boom")`, "boom"},
+		{`error(1)`, "argument to `error` must be STRING, got INTEGER"},
+		{`attempt { yeet "first" } fetch (e) { yeet "second" }`, "second"},
+		{`attempt { 1 / 0 } fetch (e) { missing }`, "identifier not found: missing"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.input, func(t *testing.T) {
-			evaluated := testEval(tt.input)
+			evaluated := testEval(t, tt.input)
 
 			errObj, ok := evaluated.(*object.Error)
 			if !ok {
@@ -262,6 +446,135 @@ giving 1;
 	}
 }
 
+func TestErrorSpans(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"foo", "FUCKY WUCKY: 1:1: identifier not found: foo"},
+		{"ask x = 5;\nx + fact;", "FUCKY WUCKY: 2:1: type mismatch: INTEGER + BOOLEAN"},
+		{"ask f = funk(x) {\n  -x\n};\nf(fact);", "FUCKY WUCKY: 2:3: unknown operator: -BOOLEAN"},
+		{"thickness(1)", "FUCKY WUCKY: 1:1: argument to `thickness` not supported, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(t, tt.input)
+
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Fatalf("no error object returned. got=%T(%+v)",
+					evaluated, evaluated)
+			}
+
+			if errObj.Inspect() != tt.expected {
+				t.Errorf("wrong error. expected=%q, got=%q",
+					tt.expected, errObj.Inspect())
+			}
+		})
+	}
+}
+
+func TestStackTraces(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 / 0", "FUCKY WUCKY: 1:1: division by zero: 1 / 0"},
+		{
+			"ask inner = funk(x) {\n  x / 0\n};\nask outer = funk(x) {\n  inner(x) + 1\n};\nouter(5);",
+			"FUCKY WUCKY: 2:3: division by zero: 5 / 0\n\tin inner, called at 5:3\n\tin outer, called at 7:1",
+		},
+		{
+			"funk() {\n  missing\n}();",
+			"FUCKY WUCKY: 2:3: identifier not found: missing\n\tin funk, called at 1:1",
+		},
+		{
+			"ask f = funk(x = missing) { x };\nf();",
+			"FUCKY WUCKY: 1:18: identifier not found: missing\n\tin f, called at 2:1",
+		},
+		{
+			"ask add = funk(x, y) { x + y };\nask g = funk() { add(1) };\ng();",
+			"FUCKY WUCKY: 2:18: wrong number of arguments to `add`. got=1, want=2\n\tin g, called at 3:1",
+		},
+		{
+			"ask safe = funk() { attempt { 1 / 0 } fetch { 0 } };\nask f = funk() { safe(); missing };\nf();",
+			"FUCKY WUCKY: 2:26: identifier not found: missing\n\tin f, called at 3:1",
+		},
+		{
+			"ask f = funk(n) {\n  1 + f(n + 1)\n};\nf(0);",
+			"FUCKY WUCKY: 2:7: maximum recursion depth exceeded in `f`" +
+				strings.Repeat("\n\tin f, called at 2:7", 3) +
+				"\n\t... repeated 9996 more times\n\tin f, called at 4:1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(t, tt.input)
+
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Fatalf("no error object returned. got=%T(%+v)",
+					evaluated, evaluated)
+			}
+
+			if errObj.Traceback() != tt.expected {
+				t.Errorf("wrong traceback.\nexpected=%q\ngot=     %q",
+					tt.expected, errObj.Traceback())
+			}
+		})
+	}
+}
+
+func TestCheckedArithmetic(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"9223372036854775807 + 1", "integer overflow: 9223372036854775807 + 1"},
+		{"-9223372036854775807 - 2", "integer overflow: -9223372036854775807 - 2"},
+		{"4611686018427387904 * 2", "integer overflow: 4611686018427387904 * 2"},
+		{"-1 * (-9223372036854775807 - 1)", "integer overflow: -1 * -9223372036854775808"},
+		{"9223372036854775806 + 1", 9223372036854775807},
+		{"-9223372036854775807 - 1", -9223372036854775808},
+		{"3037000499 * 3037000499", 9223372030926249001},
+		{"1 - 2", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := parser.New(l)
+			program := p.ParseProgram()
+			env := object.NewEnvironment()
+
+			checked := evaluator.New(evaluator.Options{CheckedArithmetic: true}).Eval(program, env)
+			switch expected := tt.expected.(type) {
+			case int:
+				testIntegerObject(t, checked, int64(expected))
+			case string:
+				errObj, ok := checked.(*object.Error)
+				if !ok {
+					t.Fatalf("no error object returned. got=%T(%+v)", checked, checked)
+				}
+				if errObj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q",
+						expected, errObj.Message)
+				}
+
+				// Without checking we wrap around like Go does.
+				if unchecked := evaluator.Eval(program, env); unchecked.Type() == object.ERROR_OBJ {
+					t.Errorf("unchecked evaluation errored: %s", unchecked.Inspect())
+				}
+			}
+		})
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	t.Parallel()
 	tests := []struct {
@@ -276,17 +589,73 @@ func TestLetStatements(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.input, func(t *testing.T) {
-			evaluated := testEval(tt.input)
+			evaluated := testEval(t, tt.input)
 			testIntegerObject(t, evaluated, tt.expected)
 		})
 	}
 }
 
+func TestValuelessStatements(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[consider (fact) {}, consider (cap) { 1 }]", "[or_nar, or_nar]"},
+		{"ask f = funk() { ask x = 5 }; f();", "or_nar"},
+		{"ask f = funk() {}; [f()];", "[or_nar]"},
+		{"{\"a\": consider (fact) {}}", "{a: or_nar}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+			evaluated := testEval(t, tt.input)
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("wrong result. want=%s, got=%s", tt.expected, evaluated.Inspect())
+			}
+		})
+	}
+}
+
+func TestAskShadowing(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"ask x = 1; ask f = funk() { ask x = x + 1; x }; f();", "2"},
+		{"ask x = 1; ask f = funk() { ask a = x; ask x = 5; [a, x] }; f();", "[1, 5]"},
+		{"ask x = 1; ask f = funk() { x = 3; ask x = 5; x }; [f(), x];", "[5, 3]"},
+		{"ask x = 1; ask f = funk() { ask g = funk() { x }; ask x = 2; g() }; f();", "2"},
+		{"ask x = 1; ask f = funk() { ask a = x; ask g = funk() { x }; ask x = 2; [a, g()] }; f();", "[1, 2]"},
+		{"ask f = funk() { ask thickness = thickness([1, 2]); thickness }; f();", "2"},
+		{"ask x = 1; ask f = funk(y) { sniff (y) { n => { ask x = x + n; x } } }; f(10);", "11"},
+		{"ask f = funk() { ask y = y; y }; f();", "FUCKY WUCKY: 1:26: identifier not found: y\n\tin f, called at 1:34"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+			evaluated := testEval(t, tt.input)
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Traceback() != tt.expected {
+					t.Errorf("wrong error. want=%q, got=%q", tt.expected, errObj.Traceback())
+				}
+				return
+			}
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("wrong result. want=%s, got=%s", tt.expected, evaluated.Inspect())
+			}
+		})
+	}
+}
+
 func TestFunctionObject(t *testing.T) {
 	t.Parallel()
 	input := `funk(x) { x + 2; };`
 
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	fn, ok := evaluated.(*object.Function)
 	if !ok {
 		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
@@ -319,11 +688,22 @@ func TestFunctionApplication(t *testing.T) {
 		{"ask add = funk(x, y) { x + y; }; add(5, 5);", 10},
 		{"ask add = funk(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
 		{"funk(x) { x; }(5)", 5},
+		{"ask add = funk(x, y = 2) { x + y; }; add(5);", 7},
+		{"ask add = funk(x, y = 2) { x + y; }; add(5, 5);", 10},
+		{"ask add = funk(x = 1, y = x * 3) { x + y; }; add();", 4},
+		{"ask add = funk(x = 1, y = x * 3) { x + y; }; add(2);", 8},
+		{"ask y = 100; ask f = funk(x, y = y) { x + y; }; f(1);", 101},
+		{"ask count = funk(...rest) { thickness(rest); }; count(1, 2, 3);", 3},
+		{"ask count = funk(...rest) { thickness(rest); }; count();", 0},
+		{"ask f = funk(x, ...rest) { x + thickness(rest); }; f(10, 1, 1);", 12},
+		{"ask add = funk(x, y) { x + y; }; ask pair = [3, 4]; add(...pair);", 7},
+		{"ask add = funk(x, y) { x + y; }; add(...[1], ...[2]);", 3},
+		{"ask sum = funk(...xs) { consider (thickness(xs) == 0) { 0 } however { first(xs) + sum(...bum(xs)) } }; sum(1, 2, 3, 4);", 10},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.input, func(t *testing.T) {
-			evaluated := testEval(tt.input)
+			evaluated := testEval(t, tt.input)
 			testIntegerObject(t, evaluated, tt.expected)
 		})
 	}
@@ -340,14 +720,572 @@ func TestClosures(t *testing.T) {
 	giving addTwo(3);
 	`
 
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	testIntegerObject(t, evaluated, 5)
 }
 
+func TestCapturedVariables(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"ask counter = funk() { ask n = 0; funk() { n += 1; }; }; ask c = counter(); c(); c(); c();", "3"},
+		{"ask n = 1; ask get = funk() { n; }; n = 2; get();", "2"},
+		{"ask fs = []; peruse (x in [1, 2, 3]) { fs = push(fs, funk() { x; }); }; [fs[0](), fs[1](), fs[2]()];", "[3, 3, 3]"},
+		{"ask fs = []; peruse (x in [1, 2, 3]) { sniff (x) { y => fs = push(fs, funk() { y; }) }; }; [fs[0](), fs[1](), fs[2]()];", "[1, 2, 3]"},
+		{"ask f = funk() { g(); }; ask g = funk() { 7; }; f();", "7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+			evaluated := testEval(t, tt.input)
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("wrong result. want=%s, got=%s", tt.expected, evaluated.Inspect())
+			}
+		})
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Deep enough to blow the Go stack if every call nested.
+		{"ask count = funk(n, acc) { consider (n == 0) { giving acc; }; count(n - 1, acc + 1) }; count(1000000, 0);", "1000000"},
+		{"ask count = funk(n) { consider (n == 0) { 0 } however { count(n - 1) } }; count(10000);", "0"},
+		{"ask count = funk(n) { sniff (n) { 0 => \"done\", _ => count(n - 1) } }; count(10000);", "done"},
+		{"ask even = funk(n) { consider (n == 0) { fact } however { odd(n - 1) } }; ask odd = funk(n) { consider (n == 0) { cap } however { even(n - 1) } }; even(10001);", "cap"},
+		{"ask sum = funk(xs, acc = 0) { consider (thickness(xs) == 0) { giving acc; }; sum(bum(xs), acc + first(xs)) }; sum([1, 2, 3, 4]);", "10"},
+		{"ask f = funk(n) { consider (n == 0) { yeet \"bottom\" }; f(n - 1) }; ask g = funk() { attempt { giving f(3); } fetch (e) { e[\"message\"] } }; g();", "bottom"},
+		{"ask f = funk() { thickness(\"abc\") }; f();", "3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+			evaluated := testEval(t, tt.input)
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("wrong result. want=%s, got=%s", tt.expected, evaluated.Inspect())
+			}
+		})
+	}
+}
+
+func TestTailCallTracebacks(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"ask f = funk(n) {\n  consider (n == 0) { yeet \"bottom\" }\n  f(n - 1)\n};\nf(1);",
+			"FUCKY WUCKY: 2:23: bottom\n\tin f, called at 3:3\n\tin f, called at 5:1",
+		},
+		{
+			"ask f = funk(n) {\n  consider (n == 0) { yeet \"bottom\" }\n  f(n - 1)\n};\nf(2);",
+			"FUCKY WUCKY: 2:23: bottom\n\tin f, called at 3:3\n\t... 1 tail call elided\n\tin f, called at 5:1",
+		},
+		{
+			"ask f = funk(n) {\n  consider (n == 0) { yeet \"bottom\" }\n  f(n - 1)\n};\nf(200000);",
+			"FUCKY WUCKY: 2:23: bottom\n\tin f, called at 3:3\n\t... 199999 tail calls elided\n\tin f, called at 5:1",
+		},
+		{
+			"ask even = funk(n) { consider (n == 0) { missing } however { odd(n - 1) } };\nask odd = funk(n) { even(n - 1) };\nask g = funk() { 1 + even(4) };\ng();",
+			"FUCKY WUCKY: 1:42: identifier not found: missing\n\tin even, called at 2:21\n\t... 3 tail calls elided\n\tin even, called at 3:22\n\tin g, called at 4:1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+			evaluated := testEval(t, tt.input)
+
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			}
+			if errObj.Traceback() != tt.expected {
+				t.Errorf("wrong traceback.\nexpected=%q\ngot=     %q",
+					tt.expected, errObj.Traceback())
+			}
+		})
+	}
+}
+
+func TestMaxCallDepth(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		maxDepth int
+		expected string
+	}{
+		{"ask f = funk(n) { 1 + f(n + 1) }; f(0);", 0, "maximum recursion depth exceeded in `f`"},
+		{"ask f = funk(n) { consider (n == 0) { 0 } however { 1 + f(n - 1) } }; f(5);", 5, "maximum recursion depth exceeded in `f`"},
+		{"ask f = funk(n) { consider (n == 0) { 0 } however { 1 + f(n - 1) } }; f(4);", 5, "4"},
+		{"ask f = funk(n) { consider (n == 0) { 0 } however { 1 + funk(m) { f(m) }(n - 1) } }; f(10);", 5, "maximum recursion depth exceeded in `funk`"},
+		{"ask f = funk(n) { 1 + f(n + 1) }; attempt { f(0) } fetch (e) { e[\"message\"] };", 100, "maximum recursion depth exceeded in `f`"},
+		{"attempt { ask f = funk(n) { f(n + 1) + 1 }; f(0) } fetch (e) { e[\"message\"] };", 0, "maximum recursion depth exceeded in `f`"},
+		{"ask f = funk(n, a = [n], b = a, c = b, d = c, e = d, g = e) { 1 + f(n + 1) }; f(0);", 0, "maximum recursion depth exceeded in `f`"},
+		// Tail calls don't nest, so they can go on past the limit.
+		{"ask f = funk(n) { consider (n == 0) { 0 } however { f(n - 1) } }; f(1000);", 5, "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+			evaluated := testEvalWith(t, evaluator.Options{MaxCallDepth: tt.maxDepth}, tt.input)
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != tt.expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+				}
+				return
+			}
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("wrong result. want=%s, got=%s", tt.expected, evaluated.Inspect())
+			}
+		})
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	t.Parallel()
+	tests := []string{
+		"whilst (fact) {}",
+		"ask i = 0; whilst (fact) { i += 1; }",
+		// Tail recursion never reaches MaxCallDepth, so it's up to the
+		// context to stop it.
+		"ask f = funk(n) { f(n + 1) }; f(0);",
+		"ask f = funk() { f() }; f();",
+		"peruse (i in range(0, 9223372036854775807)) { i }",
+		"attempt { whilst (fact) {} } fetch { 1 };",
+	}
+
+	for name, run := range backends {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt, func(t *testing.T) {
+				t.Parallel()
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				defer cancel()
+
+				evaluated := run(t, ctx, evaluator.Options{}, tt)
+				errObj, ok := evaluated.(*object.Error)
+				if !ok {
+					t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				}
+				if !errors.Is(errObj, context.DeadlineExceeded) {
+					t.Errorf("error isn't a deadline error. got=%q", errObj.Message)
+				}
+				if errObj.Message != "evaluation cancelled: context deadline exceeded" {
+					t.Errorf("wrong error message. got=%q", errObj.Message)
+				}
+			})
+		}
+
+		t.Run(name+"/already cancelled", func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			evaluated := run(t, ctx, evaluator.Options{}, "ask f = funk() { 1 }; f();")
+			if !errors.Is(evaluated.(*object.Error), context.Canceled) {
+				t.Errorf("error isn't a cancellation. got=%s", evaluated.Inspect())
+			}
+		})
+	}
+
+	t.Run("finishes in time", func(t *testing.T) {
+		t.Parallel()
+		evaluated := testEval(t, "ask f = funk(n) { n * 2 }; f(21);")
+		testIntegerObject(t, evaluated, 42)
+	})
+}
+
+func TestLimits(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		limits   evaluator.Limits
+		expected string
+	}{
+		{"whilst (fact) {}", evaluator.Limits{MaxSteps: 1000}, "step quota exceeded: the limit is 1000"},
+		{"ask f = funk() { f() }; f();", evaluator.Limits{MaxSteps: 1000}, "step quota exceeded: the limit is 1000"},
+		{"ask f = funk(n) { f(n + 1) }; f(0);", evaluator.Limits{MaxSteps: 1000}, "step quota exceeded: the limit is 1000"},
+		{"ask s = \"x\"; whilst (fact) { s += s; }", evaluator.Limits{MaxAllocations: 1 << 20}, "allocation quota exceeded: the limit is 1048576"},
+		{"ask xs = []; whilst (fact) { xs = push(xs, 1); }", evaluator.Limits{MaxAllocations: 10000}, "allocation quota exceeded: the limit is 10000"},
+		{"ask h = {}; ask i = 0; whilst (fact) { h[i] = i; i += 1; }", evaluator.Limits{MaxAllocations: 100}, "allocation quota exceeded: the limit is 100"},
+		{"attempt { whilst (fact) {} } fetch { 1 };", evaluator.Limits{MaxSteps: 1000}, "step quota exceeded: the limit is 1000"},
+		{"ask i = 0; whilst (i < 10) { i += 1; }; i;", evaluator.Limits{MaxSteps: 1000, MaxAllocations: 10}, "10"},
+		{"ask i = 0; whilst (i < 10) { i += 1; }; i;", evaluator.Limits{}, "10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+			l := lexer.New(tt.input)
+			p := parser.New(l)
+			program := p.ParseProgram()
+
+			evaluated := evaluator.New(evaluator.Options{Limits: tt.limits}).Eval(program, object.NewEnvironment())
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				if evaluated.Inspect() != tt.expected {
+					t.Errorf("wrong result. want=%s, got=%s", tt.expected, evaluated.Inspect())
+				}
+				return
+			}
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+			}
+			if !errors.Is(errObj, evaluator.ErrQuotaExceeded) {
+				t.Errorf("error isn't a quota error. got=%q", errObj.Message)
+			}
+		})
+	}
+}
+
+func TestUsage(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected evaluator.Usage
+	}{
+		{"1 + 2", evaluator.Usage{Steps: 5}},
+		{`"ab" + "cd"`, evaluator.Usage{Steps: 5, Allocations: 8}},
+		{"[1, 2, 3]", evaluator.Usage{Steps: 6, Allocations: 3}},
+		{`{"a": 1}`, evaluator.Usage{Steps: 5, Allocations: 2}},
+		{"push([1], 2)", evaluator.Usage{Steps: 7, Allocations: 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+			l := lexer.New(tt.input)
+			p := parser.New(l)
+			program := p.ParseProgram()
+
+			e := evaluator.New(evaluator.Options{})
+			e.Eval(program, object.NewEnvironment())
+			if e.Usage() != tt.expected {
+				t.Errorf("wrong usage. want=%+v, got=%+v", tt.expected, e.Usage())
+			}
+		})
+	}
+}
+
+func TestAssignment(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"ask x = 1; x = 2; x;", 2},
+		{"ask x = 1; x = x + 1;", 2},
+		{"ask a = 1; ask b = 2; a = b = 5; a + b;", 10},
+		{"ask x = 10; x += 5; x;", 15},
+		{"ask x = 10; x -= 5; x;", 5},
+		{"ask x = 10; x *= 5; x;", 50},
+		{"ask x = 10; x /= 5; x;", 2},
+		{"ask x = 10; x %= 4; x;", 2},
+		// The right hand side is worked out before the current value is read.
+		{"ask x = 1; ask f = funk() { x = 10; 1 }; x += f(); x;", 11},
+		{"ask a = [1]; ask f = funk() { a[0] = 10; 1 }; a[0] += f(); a[0];", 11},
+		{"ask x = 1; ask f = funk() { ask x = 5; x = 6; }; f(); x;", 1},
+		{
+			`
+ask newCounter = funk() {
+	ask count = 0;
+	funk() { count += 1; };
+};
+
+ask counter = newCounter();
+counter();
+counter();
+counter();
+`,
+			3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testIntegerObject(t, testEval(t, tt.input), tt.expected)
+		})
+	}
+}
+
+func TestWhileStatements(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"ask i = 0; whilst (i < 10) { i += 1; }; i;", 10},
+		{"ask i = 0; whilst (cap) { i += 1; }; i;", 0},
+		{"ask i = 0; whilst (fact) { i += 1; consider (i == 5) { enough; } }; i;", 5},
+		{
+			`
+ask i = 0;
+ask sum = 0;
+whilst (i < 10) {
+	i += 1;
+	consider (i % 2 == 0) { anyway; }
+	sum += i;
+}
+sum;
+`,
+			25,
+		},
+		{
+			`
+ask find = funk(xs, target) {
+	ask i = 0;
+	whilst (i < thickness(xs)) {
+		consider (xs[i] == target) { giving i; }
+		i += 1;
+	}
+	-1;
+};
+find([5, 6, 7], 7);
+`,
+			2,
+		},
+		{
+			`
+ask count = 0;
+ask i = 0;
+whilst (i < 3) {
+	i += 1;
+	ask j = 0;
+	whilst (fact) {
+		j += 1;
+		consider (j > 2) { enough; }
+		count += 1;
+	}
+}
+count;
+`,
+			6,
+		},
+		{"ask i = 0; whilst (i < 3) { i += 1; }", nil},
+		{"ask i = 0; whilst (i < 100000) { i += 1; }; i;", 100000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(t, tt.input)
+			integer, ok := tt.expected.(int)
+			if ok {
+				testIntegerObject(t, evaluated, int64(integer))
+			} else {
+				testNullObject(t, evaluated)
+			}
+		})
+	}
+}
+
+func TestLoopSignalsInExpressions(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"ask seen = []; peruse (x in [1, 2, 3]) { ask y = sniff (x) { 2 => { enough }, _ => x }; seen = push(seen, y); }; seen;", "[1]"},
+		{"ask seen = []; peruse (x in [1, 2, 3]) { seen = push(seen, consider (x == 2) { anyway } however { x }); }; seen;", "[1, 3]"},
+		{"ask i = 0; ask sum = 0; whilst (i < 5) { i += 1; sum += consider (i == 3) { anyway } however { i }; }; sum;", "12"},
+		{"ask i = 0; whilst (fact) { i += 1; ask xs = [i, consider (i == 4) { enough } however { 0 }]; }; i;", "4"},
+		{"ask f = funk() { ask y = consider (fact) { giving 5 }; 6 }; f();", "5"},
+		{"ask f = funk(x) { x + sniff (x) { 1 => { giving 10 }, _ => 0 } }; [f(1), f(2)];", "[10, 2]"},
+		{"ask seen = []; peruse (x in [1, 2, 3]) { seen = push(seen, [x, consider (x == 2) { anyway } however { 0 }]); }; seen;", "[[1, 0], [3, 0]]"},
+		{"ask i = 0; whilst (i < 100000) { i += 1; push([], consider (fact) { anyway }); }; i;", "100000"},
+		{"ask f = funk() { ask s = 0; peruse (x in [1, 2, 3, 4]) { s += consider (x == 3) { anyway } however { x }; }; s }; f();", "7"},
+		{"ask j = 0; whilst (j < 3) { j += 1; ask k = 0; whilst (consider (j == 2) { anyway } however { k < 2 }) { k += 1; } }; j;", "3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+			evaluated := testEval(t, tt.input)
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("wrong result. want=%s, got=%s", tt.expected, evaluated.Inspect())
+			}
+		})
+	}
+}
+
+func TestForInStatements(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"ask sum = 0; peruse (x in [1, 2, 3]) { sum += x; }; sum;", "6"},
+		{"ask out = []; peruse (i, x in [5, 6]) { out = push(out, i * 10 + x); }; out;", "[5, 16]"},
+		{`ask out = ""; peruse (c in "héy🐶") { out = out + c + "."; }; out;`, "h.é.y.🐶."},
+		{`ask out = []; peruse (i, c in "ab") { out = push(out, i); }; out;`, "[0, 1]"},
+		{`ask out = []; peruse (k in {"b": 2, "a": 1, "c": 3}) { out = push(out, k); }; out;`, "[a, b, c]"},
+		{`ask sum = 0; peruse (k, v in {"b": 2, "a": 1}) { sum += v; }; sum;`, "3"},
+		{`ask out = []; peruse (k in {10: 0, 9: 0, "1": 0, 1: 0, 1.5: 0, fact: 0, cap: 0}) { out = push(out, k); }; out;`, "[cap, fact, 1, 1.5, 9, 10, 1]"},
+		{"ask out = []; peruse (n in range(4)) { out = push(out, n); }; out;", "[0, 1, 2, 3]"},
+		{"ask out = []; peruse (n in range(2, 5)) { out = push(out, n); }; out;", "[2, 3, 4]"},
+		{"ask out = []; peruse (n in range(10, 0, -3)) { out = push(out, n); }; out;", "[10, 7, 4, 1]"},
+		{"ask out = []; peruse (i, n in range(5, 7)) { out = push(out, i); }; out;", "[0, 1]"},
+		{"ask out = []; peruse (n in range(5, 0)) { out = push(out, n); }; out;", "[]"},
+		{"ask count = 0; peruse (n in range(9223372036854775806, 9223372036854775807)) { count += 1; }; count;", "1"},
+		{"ask count = 0; peruse (n in range(9223372036854775800, 9223372036854775807, 5)) { count += 1; }; count;", "2"},
+		{"ask last = 0; peruse (n in range(1000000)) { last = n; }; last;", "999999"},
+		{
+			`
+ask sum = 0;
+peruse (n in range(100)) {
+	consider (n % 2 == 1) { anyway; }
+	consider (n > 10) { enough; }
+	sum += n;
+}
+sum;
+`,
+			"30",
+		},
+		{"ask f = funk(xs) { peruse (x in xs) { consider (x > 1) { giving x; } }; 0 }; f([1, 2, 3]);", "2"},
+		{"peruse (x in []) { x }", "or_nar"},
+		{"range(1, 10, 2)", "range(1, 10, 2)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(t, tt.input)
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("wrong result. want=%q, got=%q", tt.expected, evaluated.Inspect())
+			}
+		})
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`sniff (1) { 0 => "zero", 1 => "one", _ => "many" }`, "one"},
+		{`sniff (7) { 0 => "zero", 1 => "one", _ => "many" }`, "many"},
+		{`sniff (-1) { -1 => "minus one", _ => "other" }`, "minus one"},
+		{`sniff (2.0) { 2 => "two", _ => "other" }`, "two"},
+		{`sniff ("b") { "a" => 1, "b" => 2 }`, "2"},
+		{`sniff (cap) { fact => "yes", cap => "no" }`, "no"},
+		{`sniff ("1") { 1 => "int", "1" => "string" }`, "string"},
+		{`sniff (5) { n => n * 2 }`, "10"},
+		{`sniff ([1, 2]) { [] => "empty", [x] => "one", [x, y] => x + y }`, "3"},
+		{`sniff ([]) { [] => "empty", _ => "other" }`, "empty"},
+		{`sniff ([1, 2, 3]) { [x, y] => "two", _ => "other" }`, "other"},
+		{`sniff ([1, 2, 3]) { [first, ...rest] => rest }`, "[2, 3]"},
+		{`sniff ([1]) { [first, ...rest] => rest }`, "[]"},
+		{`sniff ([1, [2, 3]]) { [a, [b, c]] => a + b + c }`, "6"},
+		{`sniff ([1, 2]) { [_, ..._] => "some" }`, "some"},
+		{`sniff ({"kind": "circle", "r": 2}) { {"kind": "square"} => 0, {"kind": "circle", "r": r} => r * 3 }`, "6"},
+		{`sniff ({"a": 1}) { {"a": 1, "b": b} => b, {"a": a} => a }`, "1"},
+		{`sniff ({"a": [1, 2]}) { {"a": [x, y]} => x + y }`, "3"},
+		{`sniff (1) { {"a": a} => a, [x] => x, _ => "neither" }`, "neither"},
+		{`sniff (1) { 1 => {"a": 1}, _ => {} }`, "{a: 1}"},
+		{`sniff (2) { n => {n: n * 2} }`, "{2: 4}"},
+		{`sniff (2) { n => { ask m = n * 2; m } }`, "4"},
+		{`sniff (15) { n consider (n < 10) => "small", n consider (n < 20) => "medium", _ => "large" }`, "medium"},
+		{`sniff (5) { n => { ask doubled = n * 2; doubled + 1 } }`, "11"},
+		{`sniff (5) { n => { 1 } 6 => 2 }`, "1"},
+		{`ask n = 1; sniff (5) { n => n }; n;`, "1"},
+		{`ask f = funk(x) { sniff (x) { 0 => { giving "early"; } _ => "late" }; "after" }; f(0);`, "early"},
+		{`sniff (1) { 1 => consider (fact) { "chained" } }`, "chained"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(t, tt.input)
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("wrong result. want=%q, got=%q", tt.expected, evaluated.Inspect())
+			}
+		})
+	}
+}
+
+func TestTryExpressions(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`attempt { 1 } fetch (e) { 2 }`, "1"},
+		{`attempt { 1 / 0 } fetch (e) { e["message"] }`, "division by zero: 1 / 0"},
+		{`attempt { missing } fetch { "handled" }`, "handled"},
+		{`attempt { yeet "out of cheese"; 1 } fetch (e) { e["message"] }`, "out of cheese"},
+		{`attempt { error("bad input") } fetch (e) { e["message"] }`, "bad input"},
+		{"attempt {\n\t1;\n\t  yeet \"here\";\n} fetch (e) { [e[\"line\"], e[\"column\"]] }", "[3, 4]"},
+		{`attempt { yeet 42 } fetch (e) { e["message"] }`, "42"},
+		{`attempt { attempt { yeet "inner" } fetch (e) { yeet e } } fetch (e) { e["message"] }`, "inner"},
+		{`attempt { attempt { yeet "inner" } fetch (e) { yeet "outer" } } fetch (e) { e["message"] }`, "outer"},
+		{`ask e = 1; attempt { yeet "x" } fetch (e) { e }; e;`, "1"},
+		{`ask count = 0; attempt { yeet "x" } fetch { count += 1 }; count;`, "1"},
+		{`ask f = funk(x) { consider (x < 0) { yeet "negative" }; x }; attempt { f(-1) } fetch (e) { e["message"] }`, "negative"},
+		{`ask f = funk() { attempt { giving 1; } fetch { 2 }; 3 }; f();`, "1"},
+		{`ask out = []; peruse (x in [1, 0, 2]) { attempt { out = push(out, 10 / x) } fetch { anyway; } }; out;`, "[10, 5]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(t, tt.input)
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("wrong result. want=%q, got=%q", tt.expected, evaluated.Inspect())
+			}
+		})
+	}
+}
+
+func TestIndexAssignment(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"ask xs = [1, 2, 3]; xs[0] = 10; xs[0];", 10},
+		{"ask xs = [1, 2, 3]; xs[2] = 10;", 10},
+		{"ask xs = [1, 2, 3]; xs[1] += 10; xs[1];", 12},
+		{"ask xs = [1, 2, 3]; ask ys = xs; ys[0] = 5; xs[0];", 5},
+		{"ask grid = [[1, 2], [3, 4]]; grid[1][0] = 7; grid[1][0];", 7},
+		{`ask h = {"a": 1}; h["a"] = 2; h["a"];`, 2},
+		{`ask h = {}; h["new"] = 3; h["new"];`, 3},
+		{`ask h = {}; h[fact] = 4; h[1] = 5; h[fact] + h[1];`, 9},
+		{`ask h = {"count": 1}; h["count"] *= 6; h["count"];`, 6},
+		{`ask h = {"xs": [0]}; h["xs"][0] = 8; h["xs"][0];`, 8},
+		{
+			`
+ask fill = funk(xs, i) {
+	consider (i < thickness(xs)) {
+		xs[i] = i * i;
+		fill(xs, i + 1);
+	}
+};
+
+ask xs = [0, 0, 0, 0];
+fill(xs, 0);
+xs[3];
+`,
+			9,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testIntegerObject(t, testEval(t, tt.input), tt.expected)
+		})
+	}
+}
+
 func TestStringLiteral(t *testing.T) {
 	t.Parallel()
 	input := `"hello world!";`
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	str, ok := evaluated.(*object.String)
 	if !ok {
 		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
@@ -357,10 +1295,49 @@ func TestStringLiteral(t *testing.T) {
 	}
 }
 
+func TestStringEscapes(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"say \"woof\"\n"`, "say \"woof\"\n"},
+		{`"tab\tted" + "\u{21}"`, "tab\tted!"},
+		{"`raw \\n`", `raw \n`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(t, tt.input)
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			}
+			if str.Value != tt.expected {
+				t.Errorf("str.Value is not %q. got=%q", tt.expected, str.Value)
+			}
+		})
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	t.Parallel()
+	input := `ask größe = 3; ask 名前 = "🐶"; ask ñ_ñ = größe * 2; 名前 + " " + "ñ"`
+
+	evaluated := testEval(t, input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+	if str.Value != "🐶 ñ" {
+		t.Errorf("str.Value is not %q. got=%q", "🐶 ñ", str.Value)
+	}
+}
+
 func TestStringConcatenation(t *testing.T) {
 	t.Parallel()
 	input := `"ello" + " " + "govna!";`
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	str, ok := evaluated.(*object.String)
 	if !ok {
 		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
@@ -379,6 +1356,10 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`thickness("")`, 0},
 		{`thickness("govna")`, 5},
 		{`thickness("hello world!")`, 12},
+		{`thickness("héllo 🐶")`, 7},
+		{`heft("héllo 🐶")`, 11},
+		{`heft("")`, 0},
+		{`heft([1])`, "argument to `heft` must be STRING, got ARRAY"},
 		{`thickness(1)`, "argument to `thickness` not supported, got INTEGER"},
 		{`thickness("one", "two")`, "wrong number of arguments. got=2, want=1"},
 		{`thickness([1, 2, 3])`, 3},
@@ -394,15 +1375,34 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`push([], 1)`, []int{1}},
 		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
 		{`log("hello", "world!")`, nil},
+		{`int(2.9)`, 2},
+		{`int(-2.9)`, -2},
+		{`int("42")`, 42},
+		{`int("nope")`, "could not convert \"nope\" to INTEGER"},
+		{`int(fact)`, "argument to `int` not supported, got BOOLEAN"},
+		{`float(2)`, 2.0},
+		{`float("2.5")`, 2.5},
+		{`float([])`, "argument to `float` not supported, got ARRAY"},
+		{`abs(-3)`, 3},
+		{`abs(-3.5)`, 3.5},
+		{`round(2.5)`, 3},
+		{`round(-1.4)`, -1},
+		{`round(1.5, 2)`, "wrong number of arguments. got=2, want=1"},
+		{`range()`, "wrong number of arguments. got=0, want=1..3"},
+		{`range(1, 2, 3, 4)`, "wrong number of arguments. got=4, want=1..3"},
+		{`range(1.5)`, "argument to `range` must be INTEGER, got FLOAT"},
+		{`range(0, 10, 0)`, "`range` step must not be zero"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.input, func(t *testing.T) {
-			evaluated := testEval(tt.input)
+			evaluated := testEval(t, tt.input)
 
 			switch expected := tt.expected.(type) {
 			case int:
 				testIntegerObject(t, evaluated, int64(expected))
+			case float64:
+				testFloatObject(t, evaluated, expected)
 			case nil:
 				testNullObject(t, evaluated)
 			case string:
@@ -440,7 +1440,7 @@ func TestBuiltinFunctions(t *testing.T) {
 func TestArrayLiterals(t *testing.T) {
 	t.Parallel()
 	input := "[1, 2 * 2, 3 + 3];"
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	result, ok := evaluated.(*object.Array)
 	if !ok {
 		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
@@ -453,6 +1453,22 @@ func TestArrayLiterals(t *testing.T) {
 	testIntegerObject(t, result.Elements[2], 6)
 }
 
+func TestArraySpread(t *testing.T) {
+	t.Parallel()
+	input := "ask xs = [2, 3]; [1, ...xs, ...[], 4];"
+	evaluated := testEval(t, input)
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+	if len(result.Elements) != 4 {
+		t.Fatalf("array has wrong num of elements. got=%d", len(result.Elements))
+	}
+	for i, expected := range []int64{1, 2, 3, 4} {
+		testIntegerObject(t, result.Elements[i], expected)
+	}
+}
+
 func TestArrayIndexExpressions(t *testing.T) {
 	t.Parallel()
 	tests := []struct {
@@ -472,7 +1488,7 @@ func TestArrayIndexExpressions(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.input, func(t *testing.T) {
-			evaluated := testEval(tt.input)
+			evaluated := testEval(t, tt.input)
 
 			switch expected := tt.expected.(type) {
 			case int:
@@ -496,7 +1512,7 @@ func TestHashLiterals(t *testing.T) {
 	cap: 6
 }`
 
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	result, ok := evaluated.(*object.Hash)
 	if !ok {
 		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
@@ -508,8 +1524,8 @@ func TestHashLiterals(t *testing.T) {
 		(&object.String{Value: "three"}).HashKey(): 3,
 		(&object.Integer{Value: 4}).HashKey():      4,
 		(&object.Integer{Value: 5}).HashKey():      5,
-		TRUE.HashKey():                             5,
-		FALSE.HashKey():                            6,
+		evaluator.TRUE.HashKey():                   5,
+		evaluator.FALSE.HashKey():                  6,
 	}
 
 	if len(result.Pairs) != len(expected) {
@@ -538,11 +1554,14 @@ func TestHashIndexExpressions(t *testing.T) {
 		{`{5: 5}[5]`, 5},
 		{`{fact: 5}[fact]`, 5},
 		{`{cap: 5}[cap]`, 5},
+		{`{1: 5}[1.0]`, 5},
+		{`{2.0: 5}[2]`, 5},
+		{`{1.5: 5}[1]`, nil},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.input, func(t *testing.T) {
-			evaluated := testEval(tt.input)
+			evaluated := testEval(t, tt.input)
 
 			integer, ok := tt.expected.(int)
 			if ok {
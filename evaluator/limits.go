@@ -0,0 +1,85 @@
+package evaluator
+
+import (
+	"errors"
+
+	"github.com/Linkinlog/MagLang/object"
+)
+
+// ErrQuotaExceeded is the Cause of the error evaluation stops with when a
+// program goes over one of its Limits.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Limits caps the resources a program may use, so untrusted code can be run
+// without it hogging the host. Zero fields mean no limit.
+type Limits struct {
+	// MaxSteps caps how many nodes may be evaluated.
+	MaxSteps int64
+	// MaxAllocations caps how much the program may allocate, counted as one
+	// per array element, hash pair and string byte it creates. It's a rough
+	// measure: values that are thrown away right after count the same as
+	// ones that are kept around.
+	MaxAllocations int64
+}
+
+// Usage is how much an Evaluator has used of what Limits cover.
+type Usage struct {
+	Steps       int64
+	Allocations int64
+}
+
+// Usage reports what the Evaluator has used so far. It adds up everything
+// evaluated with it, so use a new Evaluator per program to measure each on
+// its own.
+func (e *Evaluator) Usage() Usage {
+	return e.usage
+}
+
+// step counts a node being evaluated, failing once there have been too
+// many.
+func (e *Evaluator) step() *object.Error {
+	e.usage.Steps++
+	if e.opts.Limits.MaxSteps > 0 && e.usage.Steps > e.opts.Limits.MaxSteps {
+		return quotaError("step quota exceeded: the limit is %d", e.opts.Limits.MaxSteps)
+	}
+	return nil
+}
+
+// allocate counts n units being allocated, failing once there have been too
+// many.
+func (e *Evaluator) allocate(n int64) *object.Error {
+	e.usage.Allocations += n
+	if e.opts.Limits.MaxAllocations > 0 && e.usage.Allocations > e.opts.Limits.MaxAllocations {
+		return quotaError("allocation quota exceeded: the limit is %d", e.opts.Limits.MaxAllocations)
+	}
+	return nil
+}
+
+// track counts obj as newly allocated, returning it unless that goes over
+// the quota.
+func (e *Evaluator) track(obj object.Object) object.Object {
+	if err := e.allocate(allocationSize(obj)); err != nil {
+		return err
+	}
+	return obj
+}
+
+// allocationSize is how many units obj counts as, see Limits. Scalars are
+// too small to bother with.
+func allocationSize(obj object.Object) int64 {
+	switch obj := obj.(type) {
+	case *object.Array:
+		return int64(len(obj.Elements))
+	case *object.Hash:
+		return int64(len(obj.Pairs))
+	case *object.String:
+		return int64(len(obj.Value))
+	}
+	return 0
+}
+
+func quotaError(format string, a ...any) *object.Error {
+	err := newError(format, a...)
+	err.Cause = ErrQuotaExceeded
+	return err
+}
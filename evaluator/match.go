@@ -0,0 +1,147 @@
+package evaluator
+
+import (
+	"github.com/Linkinlog/MagLang/ast"
+	"github.com/Linkinlog/MagLang/object"
+)
+
+// evalMatchExpression evaluates the body of the first arm whose pattern
+// matches the subject and whose guard, if any, is truthy. Names bound by a
+// pattern only live as long as their arm.
+func (e *Evaluator) evalMatchExpression(node *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := e.Eval(node.Subject, env)
+	if isAbrupt(subject) {
+		return subject
+	}
+
+	for _, arm := range node.Arms {
+		armEnv := object.NewEnclosedEnvironment(env)
+
+		matched, err := e.matchPattern(arm.Pattern, subject, armEnv)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			continue
+		}
+
+		if arm.Guard != nil {
+			guard := e.Eval(arm.Guard, armEnv)
+			if isAbrupt(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+
+		return e.Eval(arm.Body, armEnv)
+	}
+
+	return newError("no sniff arm matched %s", subject.Inspect())
+}
+
+// matchPattern reports whether value fits pattern, binding any names in the
+// pattern into env as it goes.
+func (e *Evaluator) matchPattern(pattern ast.Expression, value object.Object, env *object.Environment) (bool, *object.Error) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			env.Set(pattern.Value, value)
+		}
+		return true, nil
+	case *ast.ArrayLiteral:
+		return e.matchArrayPattern(pattern, value, env)
+	case *ast.HashLiteral:
+		return e.matchHashPattern(pattern, value, env)
+	default:
+		literal := e.Eval(pattern, env)
+		if err, ok := literal.(*object.Error); ok {
+			return false, err
+		}
+		return objectsEqual(literal, value), nil
+	}
+}
+
+func (e *Evaluator) matchArrayPattern(pattern *ast.ArrayLiteral, value object.Object, env *object.Environment) (bool, *object.Error) {
+	array, ok := value.(*object.Array)
+	if !ok {
+		return false, nil
+	}
+
+	elements := pattern.Elements
+	var rest *ast.Identifier
+	if len(elements) > 0 {
+		if spread, ok := elements[len(elements)-1].(*ast.SpreadExpression); ok {
+			rest = spread.Value.(*ast.Identifier)
+			elements = elements[:len(elements)-1]
+		}
+	}
+
+	if len(array.Elements) < len(elements) || rest == nil && len(array.Elements) != len(elements) {
+		return false, nil
+	}
+
+	for i, element := range elements {
+		matched, err := e.matchPattern(element, array.Elements[i], env)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+
+	if rest != nil && rest.Value != "_" {
+		remaining := make([]object.Object, len(array.Elements)-len(elements))
+		copy(remaining, array.Elements[len(elements):])
+		env.Set(rest.Value, &object.Array{Elements: remaining})
+	}
+
+	return true, nil
+}
+
+// matchHashPattern matches when every key in the pattern is in the hash and
+// its value matches. Keys the pattern doesn't mention are ignored.
+func (e *Evaluator) matchHashPattern(pattern *ast.HashLiteral, value object.Object, env *object.Environment) (bool, *object.Error) {
+	hash, ok := value.(*object.Hash)
+	if !ok {
+		return false, nil
+	}
+
+	for keyNode, valueNode := range pattern.Pairs {
+		key := e.Eval(keyNode, env)
+		if err, ok := key.(*object.Error); ok {
+			return false, err
+		}
+
+		pair, ok := hash.Pairs[key.(object.Hashable).HashKey()]
+		if !ok {
+			return false, nil
+		}
+
+		matched, err := e.matchPattern(valueNode, pair.Value, env)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// objectsEqual compares a literal pattern against a value. Numbers compare
+// by value whether they're integers or floats.
+func objectsEqual(a, b object.Object) bool {
+	switch {
+	case a.Type() == object.INTEGER_OBJ && b.Type() == object.INTEGER_OBJ:
+		return a.(*object.Integer).Value == b.(*object.Integer).Value
+	case isNumber(a) && isNumber(b):
+		return toFloat(a) == toFloat(b)
+	case a.Type() != b.Type():
+		return false
+	}
+
+	switch a := a.(type) {
+	case *object.String:
+		return a.Value == b.(*object.String).Value
+	default:
+		return a == b
+	}
+}
@@ -0,0 +1,55 @@
+package evaluator
+
+import "github.com/Linkinlog/MagLang/object"
+
+// The functions here expose the evaluator's semantics to the vm package, so
+// compiled programs compute the same values and fail with the same errors
+// as evaluated ones.
+
+// Infix applies a binary operator other than && and ||, which short
+// circuit, to already evaluated operands.
+func (e *Evaluator) Infix(operator string, left, right object.Object) object.Object {
+	return e.evalInfixExpression(operator, left, right)
+}
+
+// Prefix applies a prefix operator to an already evaluated operand.
+func Prefix(operator string, right object.Object) object.Object {
+	return evalPrefixExpression(operator, right)
+}
+
+// IsTruthy reports whether obj counts as true in a condition.
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
+// Index looks up index in left, like left[index].
+func Index(left, index object.Object) object.Object {
+	return evalIndexExpression(left, index)
+}
+
+// AssignIndex stores val at left[index], where operator is "=" or a
+// compound operator like "+=".
+func (e *Evaluator) AssignIndex(operator string, left, index, val object.Object) object.Object {
+	return e.assignIndex(operator, left, index, val)
+}
+
+// Iterate returns what peruse visits in iterable, see iterate, or false if
+// it can't be perused.
+func Iterate(iterable object.Object, keyed bool) (func() (key, value object.Object, ok bool), bool) {
+	return iterate(iterable, keyed)
+}
+
+// ThrownError is the error `yeet val` fails with.
+func ThrownError(val object.Object) *object.Error {
+	return thrownError(val)
+}
+
+// ErrorToHash is what a fetch handler sees for err.
+func ErrorToHash(err *object.Error) *object.Hash {
+	return errorToHash(err)
+}
+
+// PatternEquals reports whether value matches a literal sniff pattern.
+func PatternEquals(literal, value object.Object) bool {
+	return objectsEqual(literal, value)
+}
@@ -0,0 +1,52 @@
+package evaluator
+
+import "github.com/Linkinlog/MagLang/ast"
+
+// tailCalls finds the calls in a funk body whose value is what the funk
+// returns, so the evaluator can make them once the funk is done with its
+// own frame. Those are calls that end the body, the branches of a consider
+// or sniff that ends it, or that are given from anywhere in it. Nothing in
+// an attempt's body counts, since the attempt has to be around to catch
+// whatever the call fails with.
+type tailCalls map[*ast.CallExpression]bool
+
+func (tc tailCalls) scanBlock(block *ast.BlockStatement, tail bool) {
+	if block == nil {
+		return
+	}
+
+	for i, statement := range block.Statements {
+		tc.scanStatement(statement, tail && i == len(block.Statements)-1)
+	}
+}
+
+func (tc tailCalls) scanStatement(statement ast.Statement, tail bool) {
+	switch statement := statement.(type) {
+	case *ast.ReturnStatement:
+		tc.scanExpression(statement.ReturnValue, true)
+	case *ast.ExpressionStatement:
+		tc.scanExpression(statement.Expression, tail)
+	case *ast.WhileStatement:
+		tc.scanBlock(statement.Body, false)
+	case *ast.ForInStatement:
+		tc.scanBlock(statement.Body, false)
+	}
+}
+
+func (tc tailCalls) scanExpression(exp ast.Expression, tail bool) {
+	switch exp := exp.(type) {
+	case *ast.CallExpression:
+		if tail {
+			tc[exp] = true
+		}
+	case *ast.IfExpression:
+		tc.scanBlock(exp.Consequence, tail)
+		tc.scanBlock(exp.Alternative, tail)
+	case *ast.MatchExpression:
+		for _, arm := range exp.Arms {
+			tc.scanBlock(arm.Body, tail)
+		}
+	case *ast.TryExpression:
+		tc.scanBlock(exp.Handler, tail)
+	}
+}
@@ -1,50 +1,118 @@
 package lexer
 
-import "github.com/Linkinlog/MagLang/token"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Linkinlog/MagLang/diagnostic"
+	"github.com/Linkinlog/MagLang/token"
+)
 
 // Lexer struct 
 type Lexer struct {
 	input        string
-	position     int  // the current position we are at in the input
-	readPosition int  // the position we will be reading from
-	char         byte // current char we are examining
+	position     int  // the current byte position we are at in the input
+	readPosition int  // the byte position we will be reading from
+	char         rune // current char we are examining
+	line         int  // the line char sits on
+	column       int  // the column char sits on, counted in chars not bytes
+
+	comments []token.Token // comments skipped so far, kept around as trivia
+	errors   []diagnostic.Diagnostic
 }
 
 // New function 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
 // readChar method 
-// Sets Lexer.char to be the character at Lexer.readPosition.
+// Sets Lexer.char to be the UTF-8 character at Lexer.readPosition.
 // At the EOF we set Lexer.char to "NUL."
 func (l *Lexer) readChar() {
-	eofByte := byte(0)
+	if l.char == '\n' {
+		l.line += 1
+		l.column = 1
+	} else {
+		l.column += 1
+	}
+	width := 1
 	if l.readPosition >= len(l.input) {
-		l.char = eofByte
+		l.char = 0
 	} else {
-		l.char = l.input[l.readPosition]
+		l.char, width = utf8.DecodeRuneInString(l.input[l.readPosition:])
 	}
 	// advance position and readPosition
 	l.position = l.readPosition
-	l.readPosition += 1
+	l.readPosition += width
 }
 
-func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
-		return 0
+func (l *Lexer) peekChar() rune {
+	return l.peekCharAt(0)
+}
+
+// peekCharAt looks offset chars past the one peekChar would return.
+func (l *Lexer) peekCharAt(offset int) rune {
+	position := l.readPosition
+	for {
+		if position >= len(l.input) {
+			return 0
+		}
+		char, width := utf8.DecodeRuneInString(l.input[position:])
+		if offset == 0 {
+			return char
+		}
+		offset -= 1
+		position += width
 	}
-	return l.input[l.readPosition]
 }
 
-func (l *Lexer) NextToken() (toke token.Token) {
-	l.skipWhitespace()
+// Comments returns every comment the lexer has skipped over so far, in
+// source order, so tooling like a formatter can put them back.
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
+}
+
+// Errors returns the problems the lexer ran into, like an unterminated
+// block comment.
+func (l *Lexer) Errors() []diagnostic.Diagnostic {
+	return l.errors
+}
+
+// pos returns the position of the current char.
+func (l *Lexer) pos() token.Position {
+	return token.Position{Line: l.line, Column: l.column, Offset: l.position}
+}
+
+// PeekToken returns the token NextToken would, without moving past it.
+func (l *Lexer) PeekToken() token.Token {
+	ahead := *l
+	ahead.comments, ahead.errors = nil, nil
+	return ahead.NextToken()
+}
+
+func (l *Lexer) NextToken() token.Token {
+	l.skipTrivia()
+	start := l.pos()
+	toke := l.readToken()
+	toke.Span = token.Span{Start: start, End: l.pos()}
+	return toke
+}
+
+func (l *Lexer) readToken() (toke token.Token) {
 	if l.char == '"' {
 		toke.Type = token.STRING
 		toke.Literal = l.readString()
-		l.readChar()
+		return toke
+	}
+	if l.char == '`' {
+		toke.Type = token.STRING
+		toke.Literal = l.readRawString()
 		return toke
 	}
 	if isLetter(l.char) {
@@ -53,14 +121,16 @@ func (l *Lexer) NextToken() (toke token.Token) {
 		return toke
 	}
 	if isDigit(l.char) {
-		toke.Type = token.INT
-		toke.Literal = l.readNumberOrIdentifier(isDigit)
+		toke.Literal, toke.Type = l.readNumber()
 		return toke
 	}
 
-	tokenType, ok := token.TokenTypes[l.char]
-	if !ok {
-		return newToken(token.ILLEGAL, l.char)
+	if l.char == '.' && l.peekChar() == '.' && l.peekCharAt(1) == '.' {
+		toke = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		l.readChar()
+		l.readChar()
+		l.readChar()
+		return toke
 	}
 	if isTwoCharToken(l.char, l.peekChar()) {
 		toke = makeTwoCharToken(l.char, l.peekChar())
@@ -68,6 +138,12 @@ func (l *Lexer) NextToken() (toke token.Token) {
 		l.readChar()
 		return toke
 	}
+	tokenType, ok := token.TokenTypes[l.char]
+	if !ok {
+		toke = newToken(token.ILLEGAL, l.char)
+		l.readChar()
+		return toke
+	}
 	if tokenType == token.EOF {
 		toke.Literal = ""
 		toke.Type = tokenType
@@ -78,18 +154,156 @@ func (l *Lexer) NextToken() (toke token.Token) {
 	return toke
 }
 
+// readString reads a double quoted string, decoding escape sequences along
+// the way. Like raw strings, it's free to span multiple lines. It leaves the
+// lexer just past the closing quote.
 func (l *Lexer) readString() string {
-	position := l.position + 1
-	for {
+	start := l.pos()
+	var out strings.Builder
+
+	l.readChar()
+	for l.char != '"' {
+		switch l.char {
+		case 0:
+			l.unterminatedString(start, '"')
+			return out.String()
+		case '\\':
+			l.readEscape(&out)
+		default:
+			out.WriteRune(l.char)
+			l.readChar()
+		}
+	}
+	l.readChar()
+
+	return out.String()
+}
+
+// readEscape decodes the escape sequence starting at the current backslash
+// into out.
+func (l *Lexer) readEscape(out *strings.Builder) {
+	start := l.pos()
+	l.readChar()
+
+	switch l.char {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case 'r':
+		out.WriteByte('\r')
+	case '"':
+		out.WriteByte('"')
+	case '\\':
+		out.WriteByte('\\')
+	case 'u':
+		l.readUnicodeEscape(start, out)
+		return
+	case 0:
+		// Let readString report the unterminated string.
+		return
+	case '\n':
+		// Leave the newline for readString to keep.
+		l.addError(diagnostic.InvalidEscape, start, l.pos(),
+			`valid escapes are \n, \t, \r, \", \\ and \u{...}`,
+			"unknown escape sequence \\ at the end of a line")
+		return
+	default:
+		l.readChar()
+		l.addError(diagnostic.InvalidEscape, start, l.pos(),
+			`valid escapes are \n, \t, \r, \", \\ and \u{...}`,
+			"unknown escape sequence %s", l.input[start.Offset:l.position])
+		return
+	}
+	l.readChar()
+}
+
+// readUnicodeEscape decodes a \u{...} escape, where the braces hold the
+// code point in hex, e.g. \u{1F436}.
+func (l *Lexer) readUnicodeEscape(start token.Position, out *strings.Builder) {
+	l.readChar()
+	if l.char != '{' {
+		l.addError(diagnostic.InvalidEscape, start, l.pos(), "write it like \\u{1F436}",
+			"unicode escape is missing its {")
+		return
+	}
+
+	l.readChar()
+	digits := l.position
+	for isHexDigit(l.char) {
 		l.readChar()
-		if l.char == '"' || l.char == 0 {
-			break
+	}
+	hex := l.input[digits:l.position]
+
+	if l.char != '}' {
+		l.addError(diagnostic.InvalidEscape, start, l.pos(), "write it like \\u{1F436}",
+			"unicode escape is missing its }")
+		return
+	}
+	l.readChar()
+
+	code, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || !utf8.ValidRune(rune(code)) {
+		l.addError(diagnostic.InvalidEscape, start, l.pos(), "",
+			"invalid unicode code point %s", l.input[start.Offset:l.position])
+		return
+	}
+	out.WriteRune(rune(code))
+}
+
+// readRawString reads a backtick string. Nothing is escaped inside one, and
+// it's free to span multiple lines.
+func (l *Lexer) readRawString() string {
+	start := l.pos()
+
+	l.readChar()
+	position := l.position
+	for l.char != '`' {
+		if l.char == 0 {
+			l.unterminatedString(start, '`')
+			return l.input[position:l.position]
 		}
+		l.readChar()
 	}
-	return l.input[position:l.position]
+	value := l.input[position:l.position]
+	l.readChar()
+
+	return value
+}
+
+func (l *Lexer) unterminatedString(start token.Position, quote rune) {
+	end := token.Position{Line: start.Line, Column: start.Column + 1, Offset: start.Offset + 1}
+	l.addError(diagnostic.UnterminatedString, start, end,
+		fmt.Sprintf("close the string with %c", quote),
+		"unterminated string")
+}
+
+// readNumber reads an integer, or a float if it runs into a fraction or an
+// exponent, e.g. 12, 1.5, 1e3 or 2.5E-3.
+func (l *Lexer) readNumber() (string, token.TokenType) {
+	position := l.position
+	tokenType := token.TokenType(token.INT)
+
+	l.readNumberOrIdentifier(isDigit)
+	if l.char == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		l.readNumberOrIdentifier(isDigit)
+	}
+	if l.char == 'e' || l.char == 'E' {
+		next := l.peekChar()
+		if isDigit(next) || (next == '+' || next == '-') && isDigit(l.peekCharAt(1)) {
+			tokenType = token.FLOAT
+			l.readChar()
+			l.readChar()
+			l.readNumberOrIdentifier(isDigit)
+		}
+	}
+
+	return l.input[position:l.position], tokenType
 }
 
-func (l *Lexer) readNumberOrIdentifier(fn func(byte) bool) string {
+func (l *Lexer) readNumberOrIdentifier(fn func(rune) bool) string {
 	position := l.position
 	for fn(l.char) {
 		l.readChar()
@@ -97,35 +311,107 @@ func (l *Lexer) readNumberOrIdentifier(fn func(byte) bool) string {
 	return l.input[position:l.position]
 }
 
-func newToken(tokenType token.TokenType, char byte) token.Token {
+func newToken(tokenType token.TokenType, char rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(char)}
 }
 
-func isLetter(char byte) bool {
-	return 'a' <= char && char <= 'z' || 'A' <= char && char <= 'Z' || char == '_'
+// isLetter reports whether char can be part of an identifier, which is any
+// Unicode letter or an underscore.
+func isLetter(char rune) bool {
+	return unicode.IsLetter(char) || char == '_'
 }
 
-func isDigit(char byte) bool {
+func isDigit(char rune) bool {
 	return '0' <= char && char <= '9'
 }
 
-func isTwoCharToken(char byte, next byte) bool {
-	if (char == '=' || char == '!') && next == '=' {
-		return true
-	}
-	return false
+func isHexDigit(char rune) bool {
+	return isDigit(char) || 'a' <= char && char <= 'f' || 'A' <= char && char <= 'F'
+}
+
+func isTwoCharToken(char rune, next rune) bool {
+	_, ok := token.TwoCharTokenTypes[string(char)+string(next)]
+	return ok
 }
 
-func makeTwoCharToken(first byte, second byte) (toke token.Token) {
+func makeTwoCharToken(first rune, second rune) (toke token.Token) {
 	toke.Literal = string(first) + string(second)
-	if first == '!' {
-		toke.Type = token.NOT_EQ
-	} else if first == '=' {
-		toke.Type = token.EQ
+	toke.Type = token.TwoCharTokenTypes[toke.Literal]
+	return toke
+}
+
+// skipTrivia skips whitespace along with any `//` and `/* */` comments,
+// stashing the comments in Lexer.comments.
+func (l *Lexer) skipTrivia() {
+	for {
+		l.skipWhitespace()
+		if l.char != '/' {
+			return
+		}
+		switch l.peekChar() {
+		case '/':
+			l.comments = append(l.comments, l.readLineComment())
+		case '*':
+			l.comments = append(l.comments, l.readBlockComment())
+		default:
+			return
+		}
 	}
+}
+
+// readLineComment reads a `//` comment up to, but not including, the newline.
+func (l *Lexer) readLineComment() token.Token {
+	toke := token.Token{Type: token.COMMENT}
+	start := l.pos()
+	for l.char != '\n' && l.char != 0 {
+		l.readChar()
+	}
+	toke.Literal = l.input[start.Offset:l.position]
+	toke.Span = token.Span{Start: start, End: l.pos()}
 	return toke
 }
 
+// readBlockComment reads a `/* */` comment. Block comments nest, so
+// `/* a /* b */ c */` is a single comment.
+func (l *Lexer) readBlockComment() token.Token {
+	toke := token.Token{Type: token.COMMENT}
+	start := l.pos()
+	depth := 0
+	for {
+		switch {
+		case l.char == 0:
+			toke.Literal = l.input[start.Offset:l.position]
+			toke.Span = token.Span{Start: start, End: l.pos()}
+			end := token.Position{Line: start.Line, Column: start.Column + 2, Offset: start.Offset + 2}
+			l.addError(diagnostic.UnterminatedComment, start, end,
+				"close the comment with `*/`", "unterminated block comment")
+			return toke
+		case l.char == '/' && l.peekChar() == '*':
+			depth += 1
+			l.readChar()
+		case l.char == '*' && l.peekChar() == '/':
+			depth -= 1
+			l.readChar()
+		}
+		l.readChar()
+		if depth == 0 {
+			toke.Literal = l.input[start.Offset:l.position]
+			toke.Span = token.Span{Start: start, End: l.pos()}
+			return toke
+		}
+	}
+}
+
+func (l *Lexer) addError(code diagnostic.Code, start, end token.Position, fix string, format string, a ...any) {
+	l.errors = append(l.errors, diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     code,
+		Span:     token.Span{Start: start, End: end},
+		Message:  fmt.Sprintf(format, a...),
+		Fix:      fix,
+	})
+}
+
 func (l *Lexer) skipWhitespace() {
 	for l.char == ' ' || l.char == '\t' || l.char == '\n' || l.char == '\r' {
 		l.readChar()
@@ -4,6 +4,7 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/Linkinlog/MagLang/diagnostic"
 	"github.com/Linkinlog/MagLang/token"
 )
 
@@ -18,7 +19,7 @@ func TestLexer_NextToken(t *testing.T) {
 	};
 
 	ask result = add(five, ten);
-	!-/*5;
+	!-/ *5;
 	5 < 10 > 5;
 	consider (5 < 10) {
 		giving fact;
@@ -32,6 +33,7 @@ func TestLexer_NextToken(t *testing.T) {
 	"foo bar"
 	[1, 2];
 	{"foo": "bar"}
+	whilst (fact) { enough; anyway; }
 	`
 
 	tests := []struct {
@@ -124,6 +126,16 @@ func TestLexer_NextToken(t *testing.T) {
 		{token.COLON, ":"},
 		{token.STRING, "bar"},
 		{token.RSQUIGGLE, "}"},
+		{token.WHILE, "whilst"},
+		{token.LPAREN, "("},
+		{token.TRUE, "fact"},
+		{token.RPAREN, ")"},
+		{token.LSQUIGGLE, "{"},
+		{token.BREAK, "enough"},
+		{token.SEMICOLON, ";"},
+		{token.CONTINUE, "anyway"},
+		{token.SEMICOLON, ";"},
+		{token.RSQUIGGLE, "}"},
 		{token.EOF, ""},
 	}
 
@@ -143,6 +155,333 @@ func TestLexer_NextToken(t *testing.T) {
 	}
 }
 
+func TestLexer_NextTokenSpans(t *testing.T) {
+	t.Parallel()
+	input := "ask x = 5;\n  x + 10"
+
+	tests := []struct {
+		expectedType token.TokenType
+		expectedSpan token.Span
+	}{
+		{token.LET, token.Span{Start: token.Position{Line: 1, Column: 1, Offset: 0}, End: token.Position{Line: 1, Column: 4, Offset: 3}}},
+		{token.IDENT, token.Span{Start: token.Position{Line: 1, Column: 5, Offset: 4}, End: token.Position{Line: 1, Column: 6, Offset: 5}}},
+		{token.ASSIGN, token.Span{Start: token.Position{Line: 1, Column: 7, Offset: 6}, End: token.Position{Line: 1, Column: 8, Offset: 7}}},
+		{token.INT, token.Span{Start: token.Position{Line: 1, Column: 9, Offset: 8}, End: token.Position{Line: 1, Column: 10, Offset: 9}}},
+		{token.SEMICOLON, token.Span{Start: token.Position{Line: 1, Column: 10, Offset: 9}, End: token.Position{Line: 1, Column: 11, Offset: 10}}},
+		{token.IDENT, token.Span{Start: token.Position{Line: 2, Column: 3, Offset: 13}, End: token.Position{Line: 2, Column: 4, Offset: 14}}},
+		{token.PLUS, token.Span{Start: token.Position{Line: 2, Column: 5, Offset: 15}, End: token.Position{Line: 2, Column: 6, Offset: 16}}},
+		{token.INT, token.Span{Start: token.Position{Line: 2, Column: 7, Offset: 17}, End: token.Position{Line: 2, Column: 9, Offset: 19}}},
+		{token.EOF, token.Span{Start: token.Position{Line: 2, Column: 9, Offset: 19}, End: token.Position{Line: 2, Column: 9, Offset: 19}}},
+	}
+
+	l := New(input)
+
+	for idx, tt := range tests {
+		toke := l.NextToken()
+		if toke.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokenType wrong, exptected=%q, received=%q",
+				idx, tt.expectedType, toke.Type)
+		}
+
+		if toke.Span != tt.expectedSpan {
+			t.Fatalf("tests[%d] - span wrong, exptected=%+v, received=%+v",
+				idx, tt.expectedSpan, toke.Span)
+		}
+	}
+}
+
+func TestLexer_Operators(t *testing.T) {
+	t.Parallel()
+	input := `a <= b >= c && d || e % f & g | h ...i ..`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.AND, "&&"},
+		{token.IDENT, "d"},
+		{token.OR, "||"},
+		{token.IDENT, "e"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "f"},
+		{token.ILLEGAL, "&"},
+		{token.IDENT, "g"},
+		{token.ILLEGAL, "|"},
+		{token.IDENT, "h"},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "i"},
+		{token.ILLEGAL, "."},
+		{token.ILLEGAL, "."},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for idx, tt := range tests {
+		toke := l.NextToken()
+		if toke.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokenType wrong, exptected=%q, received=%q",
+				idx, tt.expectedType, toke.Type)
+		}
+
+		if toke.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - tokenLiteral wrong, exptected=%q, received=%q",
+				idx, tt.expectedLiteral, toke.Literal)
+		}
+	}
+}
+
+func TestLexer_Unicode(t *testing.T) {
+	t.Parallel()
+	input := "ask größe = \"🐶 woof\";\n名前 + ñ"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedStart   token.Position
+	}{
+		{token.LET, "ask", token.Position{Line: 1, Column: 1, Offset: 0}},
+		{token.IDENT, "größe", token.Position{Line: 1, Column: 5, Offset: 4}},
+		{token.ASSIGN, "=", token.Position{Line: 1, Column: 11, Offset: 12}},
+		{token.STRING, "🐶 woof", token.Position{Line: 1, Column: 13, Offset: 14}},
+		{token.SEMICOLON, ";", token.Position{Line: 1, Column: 21, Offset: 25}},
+		{token.IDENT, "名前", token.Position{Line: 2, Column: 1, Offset: 27}},
+		{token.PLUS, "+", token.Position{Line: 2, Column: 4, Offset: 34}},
+		{token.IDENT, "ñ", token.Position{Line: 2, Column: 6, Offset: 36}},
+		{token.EOF, "", token.Position{Line: 2, Column: 7, Offset: 38}},
+	}
+
+	l := New(input)
+
+	for idx, tt := range tests {
+		toke := l.NextToken()
+		if toke.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokenType wrong, exptected=%q, received=%q",
+				idx, tt.expectedType, toke.Type)
+		}
+
+		if toke.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - tokenLiteral wrong, exptected=%q, received=%q",
+				idx, tt.expectedLiteral, toke.Literal)
+		}
+
+		if toke.Span.Start != tt.expectedStart {
+			t.Fatalf("tests[%d] - start wrong, exptected=%+v, received=%+v",
+				idx, tt.expectedStart, toke.Span.Start)
+		}
+	}
+}
+
+func TestLexer_Numbers(t *testing.T) {
+	t.Parallel()
+	input := `5 3.14 1.5e3 2E-3 7e+2 1.e 4.x 2e`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "1.5e3"},
+		{token.FLOAT, "2E-3"},
+		{token.FLOAT, "7e+2"},
+		{token.INT, "1"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "e"},
+		{token.INT, "4"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "x"},
+		{token.INT, "2"},
+		{token.IDENT, "e"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for idx, tt := range tests {
+		toke := l.NextToken()
+		if toke.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokenType wrong, exptected=%q, received=%q",
+				idx, tt.expectedType, toke.Type)
+		}
+
+		if toke.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - tokenLiteral wrong, exptected=%q, received=%q",
+				idx, tt.expectedLiteral, toke.Literal)
+		}
+	}
+}
+
+func TestLexer_Strings(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input           string
+		expectedLiteral string
+	}{
+		{`"plain"`, "plain"},
+		{`"say \"woof\""`, `say "woof"`},
+		{`"line\nbreak\ttab\r"`, "line\nbreak\ttab\r"},
+		{`"back\\slash"`, `back\slash`},
+		{`"\u{1F436} \u{e9}"`, "\U0001F436 \u00e9"},
+		{"`raw \\n \"string\"`", `raw \n "string"`},
+		{"`multi\nline`", "multi\nline"},
+		{"\"multi\nline\"", "multi\nline"},
+		{"\"multi\n\\tline\"", "multi\n\tline"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := New(tt.input)
+			toke := l.NextToken()
+			if toke.Type != token.STRING {
+				t.Fatalf("tokenType wrong, exptected=%q, received=%q",
+					token.STRING, toke.Type)
+			}
+			if toke.Literal != tt.expectedLiteral {
+				t.Fatalf("tokenLiteral wrong, exptected=%q, received=%q",
+					tt.expectedLiteral, toke.Literal)
+			}
+			if len(l.Errors()) != 0 {
+				t.Errorf("Lexer.Errors() = %v, want none", l.Errors())
+			}
+			if next := l.NextToken(); next.Type != token.EOF {
+				t.Errorf("expected EOF after the string, got %q", next.Type)
+			}
+		})
+	}
+}
+
+func TestLexer_StringErrors(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input         string
+		expectedError string
+		expectedCode  diagnostic.Code
+	}{
+		{`ask x = "never closed`, "1:9: error: unterminated string", diagnostic.UnterminatedString},
+		{"ask x = \"one\nask y = 2;\nask z = 3;", "1:9: error: unterminated string", diagnostic.UnterminatedString},
+		{"\"end \\\nof line\"", "1:6: error: unknown escape sequence \\ at the end of a line", diagnostic.InvalidEscape},
+		{"ask x = `raw", "1:9: error: unterminated string", diagnostic.UnterminatedString},
+		{`"bad \q escape"`, "1:6: error: unknown escape sequence \\q", diagnostic.InvalidEscape},
+		{`"\u1F436"`, "1:2: error: unicode escape is missing its {", diagnostic.InvalidEscape},
+		{`"\u{1F436"`, "1:2: error: unicode escape is missing its }", diagnostic.InvalidEscape},
+		{`"\u{D800}"`, "1:2: error: invalid unicode code point \\u{D800}", diagnostic.InvalidEscape},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := New(tt.input)
+			for toke := l.NextToken(); toke.Type != token.EOF; toke = l.NextToken() {
+			}
+
+			errors := l.Errors()
+			if len(errors) != 1 {
+				t.Fatalf("Lexer.Errors() = %v, want 1 error", errors)
+			}
+			if errors[0].String() != tt.expectedError {
+				t.Errorf("Lexer.Errors()[0] = %q, want %q", errors[0], tt.expectedError)
+			}
+			if errors[0].Code != tt.expectedCode {
+				t.Errorf("wrong error code. want=%q, got=%q", tt.expectedCode, errors[0].Code)
+			}
+		})
+	}
+}
+
+func TestLexer_Comments(t *testing.T) {
+	t.Parallel()
+	input := `// leading comment
+ask x = 10; // trailing comment
+/* block /* nested */ still block */ x / 2;
+`
+
+	expectedTokens := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedLine    int
+	}{
+		{token.LET, "ask", 2},
+		{token.IDENT, "x", 2},
+		{token.ASSIGN, "=", 2},
+		{token.INT, "10", 2},
+		{token.SEMICOLON, ";", 2},
+		{token.IDENT, "x", 3},
+		{token.SLASH, "/", 3},
+		{token.INT, "2", 3},
+		{token.SEMICOLON, ";", 3},
+		{token.EOF, "", 4},
+	}
+
+	l := New(input)
+	for idx, tt := range expectedTokens {
+		toke := l.NextToken()
+		if toke.Type != tt.expectedType || toke.Literal != tt.expectedLiteral ||
+			toke.Span.Start.Line != tt.expectedLine {
+			t.Fatalf("tests[%d] - token wrong, expected=%+v, received=%+v",
+				idx, tt, toke)
+		}
+	}
+
+	expectedComments := []struct {
+		literal string
+		start   token.Position
+	}{
+		{"// leading comment", token.Position{Line: 1, Column: 1, Offset: 0}},
+		{"// trailing comment", token.Position{Line: 2, Column: 13, Offset: 31}},
+		{"/* block /* nested */ still block */", token.Position{Line: 3, Column: 1, Offset: 51}},
+	}
+	comments := l.Comments()
+	if len(comments) != len(expectedComments) {
+		t.Fatalf("wrong number of comments. want=%d, got=%d",
+			len(expectedComments), len(comments))
+	}
+	for i, want := range expectedComments {
+		if comments[i].Type != token.COMMENT {
+			t.Errorf("comments[%d] - tokenType wrong, expected=%q, received=%q",
+				i, token.COMMENT, comments[i].Type)
+		}
+		if comments[i].Literal != want.literal {
+			t.Errorf("comments[%d] - literal wrong, expected=%q, received=%q",
+				i, want.literal, comments[i].Literal)
+		}
+		if comments[i].Span.Start != want.start {
+			t.Errorf("comments[%d] - start wrong, expected=%+v, received=%+v",
+				i, want.start, comments[i].Span.Start)
+		}
+	}
+
+	if len(l.Errors()) != 0 {
+		t.Errorf("Lexer.Errors() = %v, want none", l.Errors())
+	}
+}
+
+func TestLexer_UnterminatedBlockComment(t *testing.T) {
+	t.Parallel()
+	l := New("ask x = 1;\n/* never /* closed */")
+
+	for toke := l.NextToken(); toke.Type != token.EOF; toke = l.NextToken() {
+	}
+
+	errors := l.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("Lexer.Errors() = %v, want 1 error", errors)
+	}
+
+	expected := "2:1: error: unterminated block comment"
+	if errors[0].String() != expected {
+		t.Errorf("Lexer.Errors()[0] = %q, want %q", errors[0], expected)
+	}
+	if errors[0].Code != diagnostic.UnterminatedComment {
+		t.Errorf("wrong error code. want=%q, got=%q",
+			diagnostic.UnterminatedComment, errors[0].Code)
+	}
+}
+
 func TestNew(t *testing.T) {
 	t.Parallel()
 	type args struct {
@@ -161,6 +500,8 @@ func TestNew(t *testing.T) {
 				position:     0,
 				readPosition: 1,
 				char:         'a',
+				line:         1,
+				column:       1,
 			},
 		},
 	}
@@ -179,7 +520,7 @@ func TestLexer_readChar(t *testing.T) {
 		input        string
 		position     int
 		readPosition int
-		char         byte
+		char         rune
 	}
 	tests := []struct {
 		name   string
@@ -214,7 +555,7 @@ func TestLexer_NextTokenIndividual(t *testing.T) {
 		input        string
 		position     int
 		readPosition int
-		char         byte
+		char         rune
 	}
 	tests := []struct {
 		name     string
@@ -232,6 +573,10 @@ func TestLexer_NextTokenIndividual(t *testing.T) {
 			wantToke: token.Token{
 				Type:    token.BANG,
 				Literal: "!",
+				Span: token.Span{
+					Start: token.Position{Line: 1, Column: 1, Offset: 0},
+					End:   token.Position{Line: 1, Column: 2, Offset: 1},
+				},
 			},
 		},
 		{
@@ -245,6 +590,10 @@ func TestLexer_NextTokenIndividual(t *testing.T) {
 			wantToke: token.Token{
 				Type:    token.ILLEGAL,
 				Literal: "@",
+				Span: token.Span{
+					Start: token.Position{Line: 1, Column: 1, Offset: 0},
+					End:   token.Position{Line: 1, Column: 2, Offset: 1},
+				},
 			},
 		},
 		{
@@ -258,6 +607,10 @@ func TestLexer_NextTokenIndividual(t *testing.T) {
 			wantToke: token.Token{
 				Type:    token.IDENT,
 				Literal: "foo",
+				Span: token.Span{
+					Start: token.Position{Line: 1, Column: 1, Offset: 0},
+					End:   token.Position{Line: 1, Column: 4, Offset: 3},
+				},
 			},
 		},
 		{
@@ -271,6 +624,10 @@ func TestLexer_NextTokenIndividual(t *testing.T) {
 			wantToke: token.Token{
 				Type:    token.LET,
 				Literal: "ask",
+				Span: token.Span{
+					Start: token.Position{Line: 1, Column: 1, Offset: 0},
+					End:   token.Position{Line: 1, Column: 4, Offset: 3},
+				},
 			},
 		},
 	}
@@ -281,6 +638,8 @@ func TestLexer_NextTokenIndividual(t *testing.T) {
 				position:     tt.fields.position,
 				readPosition: tt.fields.readPosition,
 				char:         tt.fields.char,
+				line:         1,
+				column:       1,
 			}
 			if gotToke := l.NextToken(); !reflect.DeepEqual(gotToke, tt.wantToke) {
 				t.Errorf("Lexer.NextToken() = %v, want %v", gotToke, tt.wantToke)
@@ -295,12 +654,12 @@ func TestLexer_readNumberOrIdentifier(t *testing.T) {
 		input        string
 		position     int
 		readPosition int
-		char         byte
+		char         rune
 	}
 	tests := []struct {
 		name   string
 		fields fields
-		fn     func(byte) bool
+		fn     func(rune) bool
 		want   string
 	}{
 		{
@@ -356,7 +715,7 @@ func Test_newToken(t *testing.T) {
 	t.Parallel()
 	type args struct {
 		tokenType token.TokenType
-		char      byte
+		char      rune
 	}
 	tests := []struct {
 		name string
@@ -387,7 +746,7 @@ func Test_newToken(t *testing.T) {
 func Test_isLetter(t *testing.T) {
 	t.Parallel()
 	type args struct {
-		char byte
+		char rune
 	}
 	tests := []struct {
 		name string
@@ -408,6 +767,20 @@ func Test_isLetter(t *testing.T) {
 			},
 			want: true,
 		},
+		{
+			name: "Test_isLetter_ß",
+			args: args{
+				char: 'ß',
+			},
+			want: true,
+		},
+		{
+			name: "Test_isLetter_🐶",
+			args: args{
+				char: '🐶',
+			},
+			want: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -421,7 +794,7 @@ func Test_isLetter(t *testing.T) {
 func Test_isDigit(t *testing.T) {
 	t.Parallel()
 	type args struct {
-		char byte
+		char rune
 	}
 	tests := []struct {
 		name string
@@ -458,7 +831,7 @@ func TestLexer_skipWhitespace(t *testing.T) {
 		input        string
 		position     int
 		readPosition int
-		char         byte
+		char         rune
 	}
 	tests := []struct {
 		name   string
@@ -493,12 +866,12 @@ func TestLexer_peekChar(t *testing.T) {
 		input        string
 		position     int
 		readPosition int
-		char         byte
+		char         rune
 	}
 	tests := []struct {
 		name   string
 		fields fields
-		want   byte
+		want   rune
 	}{
 		{
 			name: "Test_peekChar_Simple",
@@ -539,8 +912,8 @@ func TestLexer_peekChar(t *testing.T) {
 func Test_isTwoCharToken(t *testing.T) {
 	t.Parallel()
 	type args struct {
-		char byte
-		next byte
+		char rune
+		next rune
 	}
 	tests := []struct {
 		name string
@@ -563,6 +936,22 @@ func Test_isTwoCharToken(t *testing.T) {
 			},
 			want: true,
 		},
+		{
+			name: "Test_isTwoCharToken_&&",
+			args: args{
+				char: '&',
+				next: '&',
+			},
+			want: true,
+		},
+		{
+			name: "Test_isTwoCharToken_&|",
+			args: args{
+				char: '&',
+				next: '|',
+			},
+			want: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -576,8 +965,8 @@ func Test_isTwoCharToken(t *testing.T) {
 func Test_makeTwoCharToken(t *testing.T) {
 	t.Parallel()
 	type args struct {
-		first  byte
-		second byte
+		first  rune
+		second rune
 	}
 	tests := []struct {
 		name     string
@@ -606,6 +995,28 @@ func Test_makeTwoCharToken(t *testing.T) {
 				Literal: "==",
 			},
 		},
+		{
+			name: "Test_makeTwoCharToken_<=",
+			args: args{
+				first:  '<',
+				second: '=',
+			},
+			wantToke: token.Token{
+				Type:    token.LT_EQ,
+				Literal: "<=",
+			},
+		},
+		{
+			name: "Test_makeTwoCharToken_||",
+			args: args{
+				first:  '|',
+				second: '|',
+			},
+			wantToke: token.Token{
+				Type:    token.OR,
+				Literal: "||",
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
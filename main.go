@@ -7,8 +7,12 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 2 && os.Args[1] == "-vm" {
+		repl.RunFile(os.Args[2], true)
+		return
+	}
 	if len(os.Args) > 1 {
-		repl.RunFile(os.Args[1])
+		repl.RunFile(os.Args[1], false)
 		return
 	}
 	repl.Start(os.Stdin, os.Stdout)
@@ -0,0 +1,294 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Builtins are the functions available to every program, shared by the
+// evaluator and the vm. A builtin returns nil when it has nothing to give
+// back, which callers turn into null. The vm refers to builtins by their
+// index, so new ones go on the end.
+var Builtins = []struct {
+	Name    string
+	Builtin *Builtin
+}{
+	{Name: "thickness", Builtin: &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *String:
+				return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+			case *Array:
+				return &Integer{Value: int64(len(arg.Elements))}
+			default:
+				return newError("argument to `thickness` not supported, got %s",
+					args[0].Type())
+			}
+		},
+	}},
+	// heft is thickness in bytes rather than characters.
+	{Name: "heft", Builtin: &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			if args[0].Type() != STRING_OBJ {
+				return newError("argument to `heft` must be STRING, got %s",
+					args[0].Type())
+			}
+
+			return &Integer{Value: int64(len(args[0].(*String).Value))}
+		},
+	}},
+	{Name: "first", Builtin: &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `first` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
+			arr := args[0].(*Array)
+			if len(arr.Elements) > 0 {
+				return arr.Elements[0]
+			}
+
+			return nil
+		},
+	}},
+	{Name: "last", Builtin: &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `last` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
+			arr := args[0].(*Array)
+			length := len(arr.Elements)
+			if length > 0 {
+				return arr.Elements[length-1]
+			}
+
+			return nil
+		},
+	}},
+	{Name: "bum", Builtin: &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `bum` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
+			arr := args[0].(*Array)
+			length := len(arr.Elements)
+			if length > 0 {
+				newElements := make([]Object, length-1)
+				copy(newElements, arr.Elements[1:length])
+				return &Array{Elements: newElements}
+			}
+
+			return nil
+		},
+	}},
+	{Name: "push", Builtin: &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `push` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
+			arr := args[0].(*Array)
+			length := len(arr.Elements)
+
+			newElements := make([]Object, length+1)
+			copy(newElements, arr.Elements)
+			newElements[length] = args[1]
+
+			return &Array{Elements: newElements}
+		},
+	}},
+	{Name: "log", Builtin: &Builtin{
+		Fn: func(args ...Object) Object {
+			for _, arg := range args {
+				println(arg.Inspect())
+			}
+			return nil
+		},
+	}},
+	{Name: "int", Builtin: &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *Integer:
+				return arg
+			case *Float:
+				return &Integer{Value: int64(arg.Value)}
+			case *String:
+				value, err := strconv.ParseInt(arg.Value, 0, 64)
+				if err != nil {
+					return newError("could not convert %q to INTEGER", arg.Value)
+				}
+				return &Integer{Value: value}
+			default:
+				return newError("argument to `int` not supported, got %s",
+					args[0].Type())
+			}
+		},
+	}},
+	{Name: "float", Builtin: &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *Integer:
+				return &Float{Value: float64(arg.Value)}
+			case *Float:
+				return arg
+			case *String:
+				value, err := strconv.ParseFloat(arg.Value, 64)
+				if err != nil {
+					return newError("could not convert %q to FLOAT", arg.Value)
+				}
+				return &Float{Value: value}
+			default:
+				return newError("argument to `float` not supported, got %s",
+					args[0].Type())
+			}
+		},
+	}},
+	{Name: "abs", Builtin: &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *Integer:
+				if arg.Value < 0 {
+					return &Integer{Value: -arg.Value}
+				}
+				return arg
+			case *Float:
+				return &Float{Value: math.Abs(arg.Value)}
+			default:
+				return newError("argument to `abs` not supported, got %s",
+					args[0].Type())
+			}
+		},
+	}},
+	{Name: "round", Builtin: &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *Integer:
+				return arg
+			case *Float:
+				return &Integer{Value: int64(math.Round(arg.Value))}
+			default:
+				return newError("argument to `round` not supported, got %s",
+					args[0].Type())
+			}
+		},
+	}},
+	// range counts lazily, so `peruse (i in range(1000000))` doesn't build
+	// a million element array. It takes (end), (start, end) or
+	// (start, end, step).
+	{Name: "range", Builtin: &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) < 1 || len(args) > 3 {
+				return newError("wrong number of arguments. got=%d, want=1..3",
+					len(args))
+			}
+
+			bounds := make([]int64, len(args))
+			for i, arg := range args {
+				integer, ok := arg.(*Integer)
+				if !ok {
+					return newError("argument to `range` must be INTEGER, got %s",
+						arg.Type())
+				}
+				bounds[i] = integer.Value
+			}
+
+			r := &Range{Step: 1}
+			switch len(bounds) {
+			case 1:
+				r.End = bounds[0]
+			case 2:
+				r.Start, r.End = bounds[0], bounds[1]
+			case 3:
+				r.Start, r.End, r.Step = bounds[0], bounds[1], bounds[2]
+			}
+			if r.Step == 0 {
+				return newError("`range` step must not be zero")
+			}
+
+			return r
+		},
+	}},
+	// error fails on purpose with the given message, which an attempt can
+	// fetch like any other error.
+	{Name: "error", Builtin: &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			if args[0].Type() != STRING_OBJ {
+				return newError("argument to `error` must be STRING, got %s",
+					args[0].Type())
+			}
+
+			return newError("%s", args[0].(*String).Value)
+		},
+	}},
+}
+
+// GetBuiltinByName looks up a builtin, returning nil if there isn't one.
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
+}
+
+func newError(format string, a ...any) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
@@ -4,24 +4,36 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/Linkinlog/MagLang/ast"
+	"github.com/Linkinlog/MagLang/code"
+	"github.com/Linkinlog/MagLang/token"
 )
 
 type ObjectType string
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL" // TODO maybe no null?
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
+	TAIL_CALL_OBJ    = "TAIL_CALL"
 	ERROR_OBJ        = "ERROR"
 	FUNCTION_OBJ     = "FUNCTION"
 	STRING_OBJ       = "STRING"
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+	RANGE_OBJ        = "RANGE"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
 )
 
 type Object interface {
@@ -36,6 +48,20 @@ type Integer struct {
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Inspect() string {
+	out := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	// Always look like a float, so 3.0 doesn't pass for the integer 3.
+	if !strings.ContainsAny(out, ".eIN") {
+		out += ".0"
+	}
+	return out
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -60,17 +86,122 @@ type ReturnValue struct {
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 
+// Break is what evaluating `enough` produces. Like a ReturnValue it bubbles
+// up through blocks until the enclosing loop catches it.
+type Break struct{}
+
+func (b *Break) Inspect() string  { return "enough" }
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+
+// Continue is what evaluating `anyway` produces, see Break.
+type Continue struct{}
+
+func (c *Continue) Inspect() string  { return "anyway" }
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+
+// TailCall is what a call in tail position evaluates to. Rather than
+// calling Function itself, the funk hands it back to its caller, which
+// makes the call once the funk has returned so deep recursion doesn't grow
+// the Go stack.
+type TailCall struct {
+	Function  *Function
+	Arguments []Object
+	CallSite  token.Span
+}
+
+func (tc *TailCall) Inspect() string  { return "tail call" }
+func (tc *TailCall) Type() ObjectType { return TAIL_CALL_OBJ }
+
 type Error struct {
 	Message string
+	// Span points at the node that produced the error, when known.
+	Span token.Span
+	// Stack holds the funk calls that were active when the error happened,
+	// innermost first.
+	Stack []Frame
+	// Cause is the Go error behind errors that stop evaluation outright,
+	// like it being cancelled. Scripts can't attempt their way past those.
+	Cause error
+}
+
+// Frame is one funk call on the evaluator's call stack.
+type Frame struct {
+	// Function is the name the funk was bound to, or "funk" if it has none.
+	Function string
+	// CallSite is the call expression that called it.
+	CallSite token.Span
+	// TailCalls is how many tail calls before this one gave it their
+	// frame, and aren't on the stack anymore.
+	TailCalls int
+}
+
+func (e *Error) Inspect() string {
+	if e.Span.IsValid() {
+		return "FUCKY WUCKY: " + e.Span.String() + ": " + e.Message
+	}
+	return "FUCKY WUCKY: " + e.Message
+}
+
+// repeatedFrames is how many of a run of identical frames Traceback shows
+// before summing up the rest, so deep recursion doesn't bury the message
+// under thousands of lines.
+const repeatedFrames = 3
+
+// Traceback is Inspect followed by a line for each call on the stack.
+func (e *Error) Traceback() string {
+	var out bytes.Buffer
+
+	out.WriteString(e.Inspect())
+	for i := 0; i < len(e.Stack); {
+		frame := e.Stack[i]
+		run := 1
+		for i+run < len(e.Stack) && e.Stack[i+run] == frame {
+			run++
+		}
+		i += run
+
+		for range min(run, repeatedFrames) {
+			writeFrame(&out, frame)
+		}
+		switch hidden := run - repeatedFrames; {
+		case hidden == 1:
+			out.WriteString("\n\t... repeated 1 more time")
+		case hidden > 1:
+			fmt.Fprintf(&out, "\n\t... repeated %d more times", hidden)
+		}
+	}
+
+	return out.String()
+}
+
+// writeFrame writes the traceback line for frame.
+func writeFrame(out *bytes.Buffer, frame Frame) {
+	out.WriteString("\n\tin " + frame.Function)
+	if frame.CallSite.IsValid() {
+		out.WriteString(", called at " + frame.CallSite.String())
+	}
+	if frame.TailCalls == 1 {
+		out.WriteString("\n\t... 1 tail call elided")
+	} else if frame.TailCalls > 1 {
+		fmt.Fprintf(out, "\n\t... %d tail calls elided", frame.TailCalls)
+	}
 }
 
-func (e *Error) Inspect() string  { return "FUCKY WUCKY: " + e.Message }
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 
+// Error lets an Error be returned as a Go error, as the vm does.
+func (e *Error) Error() string { return e.Inspect() }
+
+// Unwrap gives errors.Is and errors.As the Cause to look at.
+func (e *Error) Unwrap() error { return e.Cause }
+
 type Function struct {
 	Parameters []*ast.Identifier
+	Defaults   map[string]ast.Expression
+	Rest       *ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Name       string
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -79,8 +210,15 @@ func (f *Function) Inspect() string {
 
 	params := []string{}
 	for _, p := range f.Parameters {
+		if def, ok := f.Defaults[p.Value]; ok {
+			params = append(params, p.String()+" = "+def.String())
+			continue
+		}
 		params = append(params, p.String())
 	}
+	if f.Rest != nil {
+		params = append(params, "..."+f.Rest.String())
+	}
 
 	out.WriteString("funk")
 	out.WriteString("(")
@@ -151,6 +289,15 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+// HashKey of a float with a whole value is the equal integer's, since
+// 1.0 == 1 and they should find the same pair.
+func (f *Float) HashKey() HashKey {
+	if f.Value == math.Trunc(f.Value) && f.Value >= math.MinInt64 && f.Value < math.MaxInt64 {
+		return (&Integer{Value: int64(f.Value)}).HashKey()
+	}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
@@ -171,7 +318,7 @@ func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for _, pair := range h.Pairs {
+	for _, pair := range h.SortedPairs() {
 		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
 	}
 
@@ -181,3 +328,139 @@ func (h *Hash) Inspect() string {
 
 	return out.String()
 }
+
+// SortedPairs returns the pairs of the hash ordered by their keys, giving
+// iteration and printing a stable order: booleans, then numbers, then
+// strings, each in their natural order.
+func (h *Hash) SortedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return keyLess(pairs[i].Key, pairs[j].Key)
+	})
+	return pairs
+}
+
+// keyRank is where a kind of hash key goes in SortedPairs. Integers and
+// floats share a rank so they sort by value together.
+func keyRank(key Object) int {
+	switch key.(type) {
+	case *Boolean:
+		return 0
+	case *Integer, *Float:
+		return 1
+	case *String:
+		return 2
+	}
+	return 3
+}
+
+func keyLess(a, b Object) bool {
+	if ra, rb := keyRank(a), keyRank(b); ra != rb {
+		return ra < rb
+	}
+
+	switch a := a.(type) {
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	case *String:
+		return a.Value < b.(*String).Value
+	case *Integer:
+		if b, ok := b.(*Integer); ok {
+			return a.Value < b.Value
+		}
+	case *Float:
+	default:
+		return a.Inspect() < b.Inspect()
+	}
+
+	// One of them is a float. NaN goes after every other number, and
+	// numbers too close to tell apart as floats put the integer first.
+	x, y := keyNumber(a), keyNumber(b)
+	switch {
+	case math.IsNaN(x) || math.IsNaN(y):
+		return !math.IsNaN(x)
+	case x != y:
+		return x < y
+	}
+	_, isInteger := a.(*Integer)
+	return isInteger
+}
+
+func keyNumber(key Object) float64 {
+	if i, ok := key.(*Integer); ok {
+		return float64(i.Value)
+	}
+	return key.(*Float).Value
+}
+
+// Range is the integers from Start up to, but not including, End, counting
+// by Step. The numbers are worked out as they're iterated over rather than
+// stored.
+type Range struct {
+	Start int64
+	End   int64
+	Step  int64
+}
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+func (r *Range) Inspect() string {
+	return fmt.Sprintf("range(%d, %d, %d)", r.Start, r.End, r.Step)
+}
+
+// Contains reports whether n is within the bounds of the range, ignoring
+// the step.
+func (r *Range) Contains(n int64) bool {
+	if r.Step > 0 {
+		return r.Start <= n && n < r.End
+	}
+	return r.End < n && n <= r.Start
+}
+
+// Next returns the value after n, and whether it's still in the range.
+// Stepping past the largest or smallest integer ends the range rather
+// than wrapping around.
+func (r *Range) Next(n int64) (int64, bool) {
+	if r.Step > 0 && n > math.MaxInt64-r.Step || r.Step < 0 && n < math.MinInt64-r.Step {
+		return 0, false
+	}
+	return n + r.Step, r.Contains(n + r.Step)
+}
+
+// CompiledFunction is a funk literal the compiler has turned into bytecode.
+type CompiledFunction struct {
+	Instructions code.Instructions
+	// Positions maps the instructions back to the source.
+	Positions code.SourceMap
+	// NumLocals counts every local slot, parameters included.
+	NumLocals     int
+	NumParameters int
+	NumDefaults   int
+	// Rest is set when the funk gathers extra arguments into an array,
+	// which goes in the slot after the parameters.
+	Rest bool
+	Name string
+	// LocalNames and FreeNames name the slots, for error messages.
+	LocalNames []string
+	FreeNames  []string
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// Closure is a CompiledFunction along with the variables it captured from
+// the funks around it. To a program it's just a funk, so it has the same
+// type as a Function.
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
@@ -1,6 +1,12 @@
 package object
 
-import "testing"
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/Linkinlog/MagLang/token"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "hello"}
@@ -20,3 +26,174 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestFloatHashKey(t *testing.T) {
+	tests := []struct {
+		float   float64
+		integer int64
+		same    bool
+	}{
+		{1, 1, true},
+		{-3, -3, true},
+		{0, 0, true},
+		{math.Copysign(0, -1), 0, true},
+		{1.5, 1, false},
+		{1e300, 0, false},
+		{math.Inf(1), math.MaxInt64, false},
+	}
+
+	for _, tt := range tests {
+		f := &Float{Value: tt.float}
+		i := &Integer{Value: tt.integer}
+		if (f.HashKey() == i.HashKey()) != tt.same {
+			t.Errorf("Float{%g} and Integer{%d} sharing a hash key wrong. want=%t", tt.float, tt.integer, tt.same)
+		}
+	}
+}
+
+func TestHashSortedPairs(t *testing.T) {
+	keys := []Hashable{
+		&String{Value: "b"},
+		&Integer{Value: 10},
+		&Float{Value: math.NaN()},
+		&String{Value: "1"},
+		&Float{Value: 2.5},
+		&Boolean{Value: true},
+		&Integer{Value: 9},
+		&String{Value: "a"},
+		&Integer{Value: -3},
+		&Boolean{Value: false},
+		&Float{Value: math.Inf(-1)},
+	}
+	expected := []string{"cap", "fact", "-Inf", "-3", "2.5", "9", "10", "NaN", "1", "a", "b"}
+
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	for _, key := range keys {
+		hash.Pairs[key.HashKey()] = HashPair{Key: key.(Object), Value: &Integer{}}
+	}
+
+	pairs := hash.SortedPairs()
+	if len(pairs) != len(expected) {
+		t.Fatalf("wrong number of pairs. want=%d, got=%d", len(expected), len(pairs))
+	}
+	for i, pair := range pairs {
+		if pair.Key.Inspect() != expected[i] {
+			t.Errorf("pair %d has wrong key. want=%s, got=%s", i, expected[i], pair.Key.Inspect())
+		}
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{1.5, "1.5"},
+		{3, "3.0"},
+		{-0.25, "-0.25"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+	}
+
+	for _, tt := range tests {
+		f := &Float{Value: tt.value}
+		if f.Inspect() != tt.expected {
+			t.Errorf("Float{%g}.Inspect() wrong. want=%q, got=%q",
+				tt.value, tt.expected, f.Inspect())
+		}
+	}
+}
+
+func TestTraceback(t *testing.T) {
+	at := func(line int) token.Span {
+		return token.Span{Start: token.Position{Line: line, Column: 1}, End: token.Position{Line: line, Column: 2}}
+	}
+	repeat := func(frame Frame, n int) []Frame {
+		frames := make([]Frame, n)
+		for i := range frames {
+			frames[i] = frame
+		}
+		return frames
+	}
+	f := Frame{Function: "f", CallSite: at(2)}
+	g := Frame{Function: "g", CallSite: at(5)}
+	tail := Frame{Function: "f", CallSite: at(2), TailCalls: 4}
+
+	tests := []struct {
+		stack    []Frame
+		expected string
+	}{
+		{nil, ""},
+		{repeat(f, 3), strings.Repeat("\n\tin f, called at 2:1", 3)},
+		{repeat(f, 4), strings.Repeat("\n\tin f, called at 2:1", 3) + "\n\t... repeated 1 more time"},
+		{
+			append(repeat(f, 10), g),
+			strings.Repeat("\n\tin f, called at 2:1", 3) + "\n\t... repeated 7 more times\n\tin g, called at 5:1",
+		},
+		{
+			append(append(repeat(f, 2), g), repeat(f, 2)...),
+			"\n\tin f, called at 2:1\n\tin f, called at 2:1\n\tin g, called at 5:1\n\tin f, called at 2:1\n\tin f, called at 2:1",
+		},
+		{
+			append(repeat(tail, 5), f),
+			strings.Repeat("\n\tin f, called at 2:1\n\t... 4 tail calls elided", 3) +
+				"\n\t... repeated 2 more times\n\tin f, called at 2:1",
+		},
+	}
+
+	for _, tt := range tests {
+		err := &Error{Message: "boom", Stack: tt.stack}
+		if got := err.Traceback(); got != "FUCKY WUCKY: boom"+tt.expected {
+			t.Errorf("wrong traceback.\nexpected=%q\ngot=     %q", "FUCKY WUCKY: boom"+tt.expected, got)
+		}
+	}
+}
+
+func TestEnvironmentAssign(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("count", &Integer{Value: 1})
+	inner := NewEnclosedEnvironment(outer)
+
+	if _, ok := inner.Assign("count", &Integer{Value: 2}); !ok {
+		t.Fatalf("Assign did not find count in the outer environment")
+	}
+
+	val, _ := outer.Get("count")
+	if val.(*Integer).Value != 2 {
+		t.Errorf("outer count not updated. got=%d", val.(*Integer).Value)
+	}
+	if _, ok := inner.store["count"]; ok {
+		t.Errorf("Assign created a new binding in the inner environment")
+	}
+
+	if _, ok := inner.Assign("missing", &Integer{Value: 1}); ok {
+		t.Errorf("Assign reported success for an undeclared name")
+	}
+	if _, ok := outer.Get("missing"); ok {
+		t.Errorf("Assign bound an undeclared name")
+	}
+}
+
+func TestRangeNext(t *testing.T) {
+	tests := []struct {
+		r        Range
+		from     int64
+		next     int64
+		expected bool
+	}{
+		{Range{Start: 0, End: 3, Step: 1}, 0, 1, true},
+		{Range{Start: 0, End: 3, Step: 1}, 2, 3, false},
+		{Range{Start: 3, End: 0, Step: -2}, 3, 1, true},
+		{Range{Start: 3, End: 0, Step: -2}, 1, -1, false},
+		{Range{Start: math.MaxInt64 - 1, End: math.MaxInt64, Step: 5}, math.MaxInt64 - 1, 0, false},
+		{Range{Start: math.MinInt64 + 1, End: math.MinInt64, Step: -5}, math.MinInt64 + 1, 0, false},
+	}
+
+	for _, tt := range tests {
+		next, ok := tt.r.Next(tt.from)
+		if ok != tt.expected || ok && next != tt.next {
+			t.Errorf("%s.Next(%d) wrong. want=(%d, %t), got=(%d, %t)",
+				tt.r.Inspect(), tt.from, tt.next, tt.expected, next, ok)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/Linkinlog/MagLang/ast"
+	"github.com/Linkinlog/MagLang/diagnostic"
 	"github.com/Linkinlog/MagLang/lexer"
 	"github.com/Linkinlog/MagLang/token"
 )
@@ -13,10 +14,13 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN      // = or +=
+	OR          // ||
+	AND         // &&
 	EQUALS      // ==
 	LESSGREATER // > or <
 	SUM         // +
-	PRODUCT     // *
+	PRODUCT     // * / %
 	PREFIX      // -X or !X
 	CALl        // myFunction(X)
 	INDEX       // array[index]
@@ -25,7 +29,19 @@ const (
 type Parser struct {
 	l *lexer.Lexer
 
-	errors []string
+	errors []diagnostic.Diagnostic
+	// panicking is set once a statement has reported an error, and silences
+	// any further errors until we synchronize on the next statement.
+	panicking bool
+	// squiggles counts the { seen so far, less the } seen, which tells
+	// synchronize which squiggles the broken statement opened itself.
+	squiggles int
+	// loopDepth counts the loops we're inside of in the current funk, so
+	// enough and anyway can be rejected anywhere else.
+	loopDepth int
+	// groups holds the spans of parenthesized expressions, parentheses
+	// and all, since the nodes themselves only cover what's inside.
+	groups map[ast.Expression]token.Span
 
 	currentToken  token.Token
 	peekABooToken token.Token
@@ -40,27 +56,40 @@ type (
 )
 
 var precendences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALl,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.PERCENT_ASSIGN:  ASSIGN,
+	token.OR:              OR,
+	token.AND:             AND,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.LT_EQ:           LESSGREATER,
+	token.GT_EQ:           LESSGREATER,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.PERCENT:         PRODUCT,
+	token.LPAREN:          CALl,
+	token.LBRACKET:        INDEX,
 }
 
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{},
+		errors: []diagnostic.Diagnostic{},
+		groups: make(map[ast.Expression]token.Span),
 	}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParse)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
@@ -69,6 +98,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.ELSE, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LSQUIGGLE, p.parseHashLiteral)
@@ -82,6 +113,17 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PERCENT_ASSIGN, p.parseAssignExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 
@@ -102,6 +144,13 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParse) {
 func (p *Parser) nextToken() {
 	p.currentToken = p.peekABooToken
 	p.peekABooToken = p.l.NextToken()
+
+	switch p.currentToken.Type {
+	case token.LSQUIGGLE:
+		p.squiggles += 1
+	case token.RSQUIGGLE:
+		p.squiggles -= 1
+	}
 }
 
 func (p *Parser) parseStringLiteral() ast.Expression {
@@ -117,12 +166,19 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program.Statements = []ast.Statement{}
 
 	for p.currentToken.Type != token.EOF {
-		//nolint:staticcheck // ill nil check if i feel like it thank you
-		if stmt := p.parseStatement(); stmt != nil {
+		squiggles := p.squiggles
+		stmt := p.parseStatement()
+		if p.panicking {
+			p.synchronize(squiggles)
+		} else if stmt != nil { //nolint:staticcheck // ill nil check if i feel like it thank you
 			program.Statements = append(program.Statements, stmt)
 		}
 		p.nextToken()
 	}
+
+	program.Comments = p.l.Comments()
+	p.errors = append(p.errors, p.l.Errors()...)
+
 	return program
 }
 
@@ -133,6 +189,22 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseAskStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForInStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.BREAK:
+		stmt := &ast.BreakStatement{Token: p.currentToken}
+		p.checkInLoop()
+		p.skipSemicolon()
+		return stmt
+	case token.CONTINUE:
+		stmt := &ast.ContinueStatement{Token: p.currentToken}
+		p.checkInLoop()
+		p.skipSemicolon()
+		return stmt
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -145,9 +217,7 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 	stmt.ReturnValue = p.parseExpression(LOWEST)
 
-	if p.peekABooTokenIs(token.SEMICOLON) {
-		p.nextToken()
-	}
+	p.skipSemicolon()
 
 	return stmt
 }
@@ -169,25 +239,128 @@ func (p *Parser) parseAskStatement() *ast.AskStatement {
 
 	stmt.Value = p.parseExpression(LOWEST)
 
-	if p.peekABooTokenIs(token.SEMICOLON) {
+	// Let the function know what it's called, so errors can name it.
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = stmt.Name.Value
+	}
+
+	p.skipSemicolon()
+
+	return stmt
+}
+
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.currentToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	p.skipSemicolon()
+
+	return stmt
+}
+
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: p.currentToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LSQUIGGLE) {
+		return nil
+	}
+
+	p.loopDepth += 1
+	stmt.Body = p.parseBlockStatement()
+	p.loopDepth -= 1
+
+	p.skipSemicolon()
+
+	return stmt
+}
+
+func (p *Parser) parseForInStatement() *ast.ForInStatement {
+	stmt := &ast.ForInStatement{Token: p.currentToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Value = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+	if p.peekABooTokenIs(token.COMMA) {
 		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Key = stmt.Value
+		stmt.Value = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
 	}
 
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LSQUIGGLE) {
+		return nil
+	}
+
+	p.loopDepth += 1
+	stmt.Body = p.parseBlockStatement()
+	p.loopDepth -= 1
+
+	p.skipSemicolon()
+
 	return stmt
 }
 
+// checkInLoop reports an error if the current enough or anyway isn't inside
+// a loop it could apply to.
+func (p *Parser) checkInLoop() {
+	if p.loopDepth == 0 {
+		p.addError(diagnostic.OutsideLoop, p.currentToken, "",
+			"%s used outside of a loop", p.currentToken.Literal)
+	}
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.currentToken}
 
 	stmt.Expression = p.parseExpression(LOWEST)
 
-	if p.peekABooTokenIs(token.SEMICOLON) {
-		p.nextToken()
-	}
+	p.skipSemicolon()
 
 	return stmt
 }
 
+// skipSemicolon steps onto an optional trailing semicolon. While recovering
+// from an error it leaves that to synchronize, which might need to stop on
+// the token we were sitting on.
+func (p *Parser) skipSemicolon() {
+	if !p.panicking && p.peekABooTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+}
+
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefix := p.prefixParseFns[p.currentToken.Type]
 	if prefix == nil {
@@ -214,9 +387,22 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	value, err := strconv.ParseInt(p.currentToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer",
-			p.currentToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(diagnostic.InvalidIntLiteral, p.currentToken, "",
+			"could not parse %q as integer", p.currentToken.Literal)
+		return nil
+	}
+	lit.Value = value
+
+	return lit
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.currentToken}
+
+	value, err := strconv.ParseFloat(p.currentToken.Literal, 64)
+	if err != nil {
+		p.addError(diagnostic.InvalidFloatLiteral, p.currentToken, "",
+			"could not parse %q as float", p.currentToken.Literal)
 		return nil
 	}
 	lit.Value = value
@@ -263,6 +449,7 @@ func (p *Parser) parseBoolean() ast.Expression {
 }
 
 func (p *Parser) parseGroupedExpression() ast.Expression {
+	open := p.currentToken
 	p.nextToken()
 
 	exp := p.parseExpression(LOWEST)
@@ -270,6 +457,9 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
+	if exp != nil {
+		p.groups[exp] = open.Span.To(p.currentToken.Span)
+	}
 
 	return exp
 }
@@ -296,6 +486,23 @@ func (p *Parser) parseIfExpression() ast.Expression {
 
 	if p.peekABooTokenIs(token.ELSE) {
 		p.nextToken()
+
+		if p.peekABooTokenIs(token.IF) {
+			// `however consider` chains nest, with the inner if as the only
+			// statement of the alternative.
+			p.nextToken()
+			block := &ast.BlockStatement{Token: p.currentToken}
+			elseIf := p.parseIfExpression()
+			if elseIf == nil {
+				return nil
+			}
+			block.Statements = []ast.Statement{
+				&ast.ExpressionStatement{Token: block.Token, Expression: elseIf},
+			}
+			expression.Alternative = block
+			return expression
+		}
+
 		if !p.expectPeek(token.LSQUIGGLE) {
 			return nil
 		}
@@ -313,8 +520,15 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	p.nextToken()
 
 	for !p.currentTokenIs(token.RSQUIGGLE) && !p.currentTokenIs(token.EOF) {
-		//nolint:staticcheck // ill nil check if i feel like it thank you
-		if stmt := p.parseStatement(); stmt != nil {
+		squiggles := p.squiggles
+		stmt := p.parseStatement()
+		if p.panicking {
+			p.synchronize(squiggles)
+			if p.currentTokenIs(token.RSQUIGGLE) {
+				// The statement broke on our closing squiggle, leave it be.
+				break
+			}
+		} else if stmt != nil { //nolint:staticcheck // ill nil check if i feel like it thank you
 			block.Statements = append(block.Statements, stmt)
 		}
 		p.nextToken()
@@ -323,6 +537,171 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	return block
 }
 
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.currentToken}
+
+	if !p.expectPeek(token.LSQUIGGLE) {
+		return nil
+	}
+
+	expression.Body = p.parseBlockStatement()
+
+	if !p.expectPeek(token.CATCH) {
+		return nil
+	}
+
+	if p.peekABooTokenIs(token.LPAREN) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		expression.Param = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.LSQUIGGLE) {
+		return nil
+	}
+
+	expression.Handler = p.parseBlockStatement()
+
+	return expression
+}
+
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{Token: p.currentToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	expression.Subject = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LSQUIGGLE) {
+		return nil
+	}
+
+	for !p.peekABooTokenIs(token.RSQUIGGLE) {
+		p.nextToken()
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		expression.Arms = append(expression.Arms, arm)
+
+		// Arms are separated by commas, which are optional after a block.
+		if arm.Body.Token.Type == token.LSQUIGGLE && !p.peekABooTokenIs(token.COMMA) {
+			continue
+		}
+		if !p.peekABooTokenIs(token.RSQUIGGLE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+
+	return expression
+}
+
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{Pattern: p.parseExpression(LOWEST)}
+	if arm.Pattern == nil || !p.checkPattern(arm.Pattern) {
+		return nil
+	}
+
+	if p.peekABooTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		arm.Guard = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.ARROW) {
+		return nil
+	}
+
+	p.nextToken()
+	if p.currentTokenIs(token.LSQUIGGLE) && !p.startsHashLiteral() {
+		arm.Body = p.parseBlockStatement()
+		return arm
+	}
+
+	stmt := &ast.ExpressionStatement{Token: p.currentToken}
+	stmt.Expression = p.parseExpression(LOWEST)
+	arm.Body = &ast.BlockStatement{Token: stmt.Token, Statements: []ast.Statement{stmt}}
+
+	return arm
+}
+
+// startsHashLiteral reports whether the { we're on opens a hash literal
+// rather than a block, going by whether it starts with a key and a :.
+// Anything else, {} included, is a block.
+func (p *Parser) startsHashLiteral() bool {
+	switch p.peekABooToken.Type {
+	case token.STRING, token.INT, token.FLOAT, token.IDENT, token.TRUE, token.FALSE:
+		return p.l.PeekToken().Type == token.COLON
+	}
+	return false
+}
+
+// checkPattern reports an error for anything in a sniff pattern that can't
+// be matched against, like a call or arithmetic.
+func (p *Parser) checkPattern(pattern ast.Expression) bool {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier, *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Boolean:
+		return true
+	case *ast.PrefixExpression:
+		switch pattern.Right.(type) {
+		case *ast.IntegerLiteral, *ast.FloatLiteral:
+			if pattern.Operator == "-" {
+				return true
+			}
+		}
+	case *ast.ArrayLiteral:
+		for i, element := range pattern.Elements {
+			spread, ok := element.(*ast.SpreadExpression)
+			if !ok {
+				if !p.checkPattern(element) {
+					return false
+				}
+				continue
+			}
+			if _, ok := spread.Value.(*ast.Identifier); !ok || i != len(pattern.Elements)-1 {
+				p.addError(diagnostic.InvalidPattern, token.Token{Span: p.spanOf(spread)},
+					"write it like [first, ...rest]",
+					"a rest pattern must be a name at the end of the array")
+				return false
+			}
+		}
+		return true
+	case *ast.HashLiteral:
+		for key, value := range pattern.Pairs {
+			switch key.(type) {
+			case *ast.StringLiteral, *ast.IntegerLiteral, *ast.Boolean:
+			default:
+				p.addError(diagnostic.InvalidPattern, token.Token{Span: p.spanOf(key)}, "",
+					"hash pattern keys must be literals, got %s", key.String())
+				return false
+			}
+			if !p.checkPattern(value) {
+				return false
+			}
+		}
+		return true
+	}
+
+	p.addError(diagnostic.InvalidPattern, token.Token{Span: p.spanOf(pattern)},
+		"patterns can be literals, names, _, or arrays and hashes of patterns",
+		"cannot match against %s", pattern.String())
+	return false
+}
+
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	lit := &ast.FunctionLiteral{Token: p.currentToken}
 
@@ -330,56 +709,141 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	if !p.parseFunctionParameters(lit) {
+		return nil
+	}
 
 	if !p.expectPeek(token.LSQUIGGLE) {
 		return nil
 	}
 
+	// A loop around the funk doesn't let its body break out of it.
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	lit.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
 
 	return lit
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	identifiers := []*ast.Identifier{}
+// parseFunctionParameters parses a parameter list like `(a, b = 2, ...rest)`
+// into lit.Parameters, lit.Defaults and lit.Rest. Once one parameter has a
+// default, every parameter after it needs one too, and a rest parameter can
+// only come last.
+func (p *Parser) parseFunctionParameters(lit *ast.FunctionLiteral) bool {
+	lit.Parameters = []*ast.Identifier{}
 
 	if p.peekABooTokenIs(token.RPAREN) {
 		p.nextToken()
-		return identifiers
+		return true
 	}
 
-	p.nextToken()
+	for {
+		if p.peekABooTokenIs(token.ELLIPSIS) {
+			p.nextToken()
+			return p.parseRestParameter(lit)
+		}
 
-	ident := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
-	identifiers = append(identifiers, ident)
+		if !p.expectPeek(token.IDENT) {
+			return false
+		}
 
-	for p.peekABooTokenIs(token.COMMA) {
-		p.nextToken()
-		p.nextToken()
 		ident := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
-		identifiers = append(identifiers, ident)
+		lit.Parameters = append(lit.Parameters, ident)
+
+		if p.peekABooTokenIs(token.ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+			if lit.Defaults == nil {
+				lit.Defaults = make(map[string]ast.Expression)
+			}
+			lit.Defaults[ident.Value] = p.parseExpression(LOWEST)
+		} else if len(lit.Defaults) > 0 {
+			p.addError(diagnostic.MissingDefault, ident.Token,
+				fmt.Sprintf("give %s a default value, or move it before the parameters that have one", ident.Value),
+				"parameter %s must have a default value since an earlier parameter does", ident.Value)
+			return false
+		}
+
+		if !p.peekABooTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
 	}
 
-	if !p.expectPeek(token.RPAREN) {
+	return p.expectPeek(token.RPAREN)
+}
+
+func (p *Parser) parseRestParameter(lit *ast.FunctionLiteral) bool {
+	if !p.expectPeek(token.IDENT) {
+		return false
+	}
+
+	lit.Rest = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+	if !p.peekABooTokenIs(token.RPAREN) {
+		p.addError(diagnostic.RestNotLast, p.peekABooToken,
+			"move the rest parameter to the end of the list",
+			"rest parameter %s must be the last parameter", lit.Rest.Value)
+		return false
+	}
+	p.nextToken()
+
+	return true
+}
+
+// parseAssignExpression parses `x = value`, `xs[i] = value` and the compound
+// forms like `x += value`. Assignment is right associative, so `a = b = 1` sets both.
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token:    p.currentToken,
+		Target:   target,
+		Operator: p.currentToken.Literal,
+	}
+
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		p.addError(diagnostic.InvalidAssignTarget, p.currentToken,
+			"only names bound with `ask` and index expressions like xs[0] can be assigned to",
+			"cannot assign to %s", target.String())
 		return nil
 	}
 
-	return identifiers
+	p.nextToken()
+	expression.Value = p.parseExpression(ASSIGN - 1)
+
+	return expression
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.currentToken, Function: function}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	exp.Close = p.currentToken
 	return exp
 }
 
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.currentToken}
 	array.Elements = p.parseExpressionList(token.RBRACKET)
+	array.Close = p.currentToken
 	return array
 }
 
+// parseListElement parses one call argument or array element, which may be
+// spread with a leading `...`.
+func (p *Parser) parseListElement() ast.Expression {
+	if !p.currentTokenIs(token.ELLIPSIS) {
+		return p.parseExpression(LOWEST)
+	}
+
+	spread := &ast.SpreadExpression{Token: p.currentToken}
+	p.nextToken()
+	spread.Value = p.parseExpression(LOWEST)
+
+	return spread
+}
+
 func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	list := []ast.Expression{}
 	if p.peekABooTokenIs(end) {
@@ -388,12 +852,12 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	}
 
 	p.nextToken()
-	list = append(list, p.parseExpression(LOWEST))
+	list = append(list, p.parseListElement())
 
 	for p.peekABooTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		list = append(list, p.parseExpression(LOWEST))
+		list = append(list, p.parseListElement())
 	}
 
 	if !p.expectPeek(end) {
@@ -412,6 +876,7 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
+	exp.Close = p.currentToken
 
 	return exp
 }
@@ -441,6 +906,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	if !p.expectPeek(token.RSQUIGGLE) {
 		return nil
 	}
+	hash.Close = p.currentToken
 
 	return hash
 }
@@ -477,18 +943,72 @@ func (p *Parser) currentTokenIs(t token.TokenType) bool {
 	return p.currentToken.Type == t
 }
 
-func (p *Parser) Errors() []string {
+// Errors returns every diagnostic produced while parsing, including the
+// ones the lexer reported.
+func (p *Parser) Errors() []diagnostic.Diagnostic {
 	return p.errors
 }
 
+// synchronize skips past the rest of a statement that failed to parse, so
+// one mistake is reported once instead of cascading. It stops on a
+// semicolon or closing squiggle, before a closing squiggle, or at the end
+// of the line. Any squiggles the statement opened, like the body of a funk
+// whose parameters were malformed, are skipped through to their close.
+// squiggles is how many were open when the statement started.
+func (p *Parser) synchronize(squiggles int) {
+	line := p.currentToken.Span.Start.Line
+	for !p.currentTokenIs(token.EOF) {
+		open := p.squiggles > squiggles
+		if p.currentTokenIs(token.RSQUIGGLE) && p.squiggles == squiggles {
+			// We just closed the last squiggle the statement opened, keep
+			// going in case a semicolon follows.
+			line = p.currentToken.Span.Start.Line
+		} else if !open && (p.currentTokenIs(token.SEMICOLON) || p.currentTokenIs(token.RSQUIGGLE)) {
+			break
+		}
+		if p.peekABooTokenIs(token.EOF) || !open &&
+			(p.peekABooTokenIs(token.RSQUIGGLE) || p.peekABooToken.Span.Start.Line > line) {
+			break
+		}
+		p.nextToken()
+	}
+	p.panicking = false
+}
+
+// spanOf is exp's span for pointing a diagnostic at, which takes in its
+// parentheses if it had any.
+func (p *Parser) spanOf(exp ast.Expression) token.Span {
+	if span, ok := p.groups[exp]; ok {
+		return span
+	}
+	return exp.Span()
+}
+
+func (p *Parser) addError(code diagnostic.Code, toke token.Token, fix string, format string, a ...any) {
+	if p.panicking {
+		return
+	}
+	p.panicking = true
+	p.errors = append(p.errors, diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     code,
+		Span:     toke.Span,
+		Message:  fmt.Sprintf(format, a...),
+		Fix:      fix,
+	})
+}
+
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s",
-		t,
-		p.peekABooToken.Type)
-	p.errors = append(p.errors, msg)
+	fix := ""
+	if len(t) == 1 {
+		// Single character token types are punctuation we can suggest adding.
+		fix = fmt.Sprintf("try adding `%s` here", t)
+	}
+	p.addError(diagnostic.UnexpectedToken, p.peekABooToken, fix,
+		"expected next token to be %s, got %s", t, p.peekABooToken.Type)
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(diagnostic.NoPrefixParseFn, p.currentToken, "",
+		"no prefix parse function for %s found", t)
 }
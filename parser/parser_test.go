@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/Linkinlog/MagLang/ast"
+	"github.com/Linkinlog/MagLang/diagnostic"
 	"github.com/Linkinlog/MagLang/lexer"
 )
 
@@ -149,6 +150,39 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"1.5e3;", 1500},
+		{"2E-3;", 0.002},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := New(l)
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+
+			if len(program.Statements) != 1 {
+				t.Fatalf("program has not enough statements. got=%d",
+					len(program.Statements))
+			}
+			stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+			if !ok {
+				t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+					program.Statements[0])
+			}
+
+			testFloatLiteral(t, stmt.Expression, tt.expected)
+		})
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	t.Parallel()
 	prefixTests := []struct {
@@ -162,6 +196,7 @@ func TestParsingPrefixExpressions(t *testing.T) {
 		{"-foobar;", "-", "foobar"},
 		{"!fact;", "!", "fact"},
 		{"!cap;", "!", "cap"},
+		{"-1.5;", "-", 1.5},
 	}
 
 	for _, tt := range prefixTests {
@@ -224,6 +259,13 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"fact == fact", "fact", "==", "fact"},
 		{"fact != cap", "fact", "!=", "cap"},
 		{"cap == cap", "cap", "==", "cap"},
+		{"1.5 * 2;", 1.5, "*", 2},
+		{"2 < 2.5;", 2, "<", 2.5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"fact && cap", "fact", "&&", "cap"},
+		{"fact || cap", "fact", "||", "cap"},
 	}
 
 	for _, tt := range infixTests {
@@ -366,6 +408,50 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a + b % c * d",
+			"(a + ((b % c) * d))",
+		},
+		{
+			"a <= b == c >= d",
+			"((a <= b) == (c >= d))",
+		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"!a && b == c || d < e",
+			"(((!a) && (b == c)) || (d < e))",
+		},
+		{
+			"x = 1 + 2",
+			"(x = (1 + 2))",
+		},
+		{
+			"a = b = c || d",
+			"(a = (b = (c || d)))",
+		},
+		{
+			"x += y * 2",
+			"(x += (y * 2))",
+		},
+		{
+			"x %= f(y -= 1)",
+			"(x %= f((y -= 1)))",
+		},
+		{
+			"xs[i + 1] = y * 2",
+			"((xs[(i + 1)]) = (y * 2))",
+		},
+		{
+			"h[\"a\"][0] += 1",
+			"(((h[a])[0]) += 1)",
+		},
 	}
 
 	for _, tt := range tests {
@@ -533,6 +619,297 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
+func TestElseIfExpression(t *testing.T) {
+	t.Parallel()
+	input := `consider (x < y) { x } however consider (x > y) { y } however { z }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(exp.Alternative.Statements) != 1 {
+		t.Fatalf("exp.Alternative.Statements does not contain 1 statements. got=%d\n",
+			len(exp.Alternative.Statements))
+	}
+
+	elseIf, ok := exp.ElseIf()
+	if !ok {
+		t.Fatalf("exp.Alternative is not an else-if. got=%q", exp.Alternative)
+	}
+
+	if !testInfixExpression(t, elseIf.Condition, "x", ">", "y") {
+		return
+	}
+
+	if _, ok := elseIf.ElseIf(); ok {
+		t.Fatalf("final however block parsed as an else-if")
+	}
+
+	alternative, ok := elseIf.Alternative.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			elseIf.Alternative.Statements[0])
+	}
+
+	if !testIdentifier(t, alternative.Expression, "z") {
+		return
+	}
+}
+
+func TestConditionalStrings(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"consider (x) { y }", "consider (x) { y }"},
+		{"consider (x < y) { ask z = x; z } however {}", "consider (x < y) { ask z = x; z } however {}"},
+		{
+			"consider (a) { 1 } however consider (!b) { 2 } however consider (f(c)) { 3 } however { 4 }",
+			"consider (a) { 1 } however consider (!b) { 2 } however consider (f(c)) { 3 } however { 4 }",
+		},
+		{"consider (a) { 1 } however { consider (b) { 2 } }", "consider (a) { 1 } however { consider (b) { 2 } }"},
+		{"whilst (fact) { enough; }", "whilst (fact) { enough; }"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := New(l)
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+
+			if program.String() != tt.expected {
+				t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+			}
+		})
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	t.Parallel()
+	input := `sniff (x) {
+	0 => "none",
+	-1 => "negative",
+	[first, ...rest] => first,
+	{"r": r} => r,
+	n consider (n > 10) => { ask big = n; big }
+	_ => x
+}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MatchExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Subject, "x") {
+		return
+	}
+
+	if len(exp.Arms) != 6 {
+		t.Fatalf("exp.Arms does not contain 6 arms. got=%d", len(exp.Arms))
+	}
+
+	if exp.Arms[4].Guard == nil {
+		t.Fatalf("exp.Arms[4].Guard is nil")
+	}
+	if !testInfixExpression(t, exp.Arms[4].Guard, "n", ">", 10) {
+		return
+	}
+	if len(exp.Arms[4].Body.Statements) != 2 {
+		t.Errorf("block body is not 2 statements. got=%d", len(exp.Arms[4].Body.Statements))
+	}
+
+	expected := "sniff (x) { 0 => none, (-1) => negative, [first, ...rest] => first, " +
+		"{r:r} => r, n consider (n > 10) => { ask big = n; big }, _ => x }"
+	if exp.String() != expected {
+		t.Errorf("exp.String() wrong. want=%q, got=%q", expected, exp.String())
+	}
+}
+
+func TestMatchArmBodies(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		isHash   bool
+		expected string
+	}{
+		{`sniff (x) { _ => {"a": 1} }`, true, "{a:1}"},
+		{`sniff (x) { _ => {x: 1} }`, true, "{x:1}"},
+		{`sniff (x) { _ => {1.5: fact} }`, true, "{1.5:fact}"},
+		{`sniff (x) { _ => { x } }`, false, "x"},
+		{`sniff (x) { _ => {} }`, false, ""},
+		{`sniff (x) { _ => { ask y = x; y } }`, false, "ask y = x;y"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := New(l)
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+
+			stmt := program.Statements[0].(*ast.ExpressionStatement)
+			body := stmt.Expression.(*ast.MatchExpression).Arms[0].Body
+
+			isHash := false
+			if len(body.Statements) == 1 {
+				if stmt, ok := body.Statements[0].(*ast.ExpressionStatement); ok {
+					_, isHash = stmt.Expression.(*ast.HashLiteral)
+				}
+			}
+			if isHash != tt.isHash {
+				t.Errorf("body parsed as a hash literal is %t, want %t", isHash, tt.isHash)
+			}
+			if body.String() != tt.expected {
+				t.Errorf("body.String() wrong. want=%q, got=%q", tt.expected, body.String())
+			}
+		})
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input         string
+		expectedParam string
+		expected      string
+	}{
+		{`attempt { risky() } fetch (e) { e["message"] }`, "e", "attempt { risky() } fetch (e) { (e[message]) }"},
+		{`attempt { yeet "nope"; } fetch { 0 }`, "", "attempt { yeet nope; } fetch { 0 }"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := New(l)
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+
+			stmt := program.Statements[0].(*ast.ExpressionStatement)
+			exp, ok := stmt.Expression.(*ast.TryExpression)
+			if !ok {
+				t.Fatalf("stmt.Expression is not ast.TryExpression. got=%T", stmt.Expression)
+			}
+
+			if tt.expectedParam == "" {
+				if exp.Param != nil {
+					t.Errorf("exp.Param is not nil. got=%q", exp.Param)
+				}
+			} else {
+				testIdentifier(t, exp.Param, tt.expectedParam)
+			}
+
+			if exp.String() != tt.expected {
+				t.Errorf("exp.String() wrong. want=%q, got=%q", tt.expected, exp.String())
+			}
+		})
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	t.Parallel()
+	input := `whilst (x < y) { consider (x) { enough; } anyway; x }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.WhileStatement. got=%T",
+			program.Statements[0])
+	}
+
+	if !testInfixExpression(t, stmt.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(stmt.Body.Statements) != 3 {
+		t.Fatalf("body is not 3 statements. got=%d\n", len(stmt.Body.Statements))
+	}
+
+	if _, ok := stmt.Body.Statements[1].(*ast.ContinueStatement); !ok {
+		t.Fatalf("stmt.Body.Statements[1] is not ast.ContinueStatement. got=%T",
+			stmt.Body.Statements[1])
+	}
+}
+
+func TestForInStatement(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input         string
+		expectedKey   string
+		expectedValue string
+		expected      string
+	}{
+		{"peruse (x in xs) { x }", "", "x", "peruse (x in xs) { x }"},
+		{"peruse (k, v in h) { v }", "k", "v", "peruse (k, v in h) { v }"},
+		{"peruse (i in range(0, n + 1)) { enough; }", "", "i", "peruse (i in range(0, (n + 1))) { enough; }"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := New(l)
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+
+			stmt, ok := program.Statements[0].(*ast.ForInStatement)
+			if !ok {
+				t.Fatalf("program.Statements[0] is not ast.ForInStatement. got=%T",
+					program.Statements[0])
+			}
+
+			if tt.expectedKey == "" {
+				if stmt.Key != nil {
+					t.Errorf("stmt.Key is not nil. got=%q", stmt.Key)
+				}
+			} else {
+				testIdentifier(t, stmt.Key, tt.expectedKey)
+			}
+			testIdentifier(t, stmt.Value, tt.expectedValue)
+
+			if stmt.String() != tt.expected {
+				t.Errorf("stmt.String() wrong. want=%q, got=%q", tt.expected, stmt.String())
+			}
+		})
+	}
+}
+
 func TestFunctionLiteralParsing(t *testing.T) {
 	t.Parallel()
 	input := `funk(x, y) { x + y; }`
@@ -614,6 +991,133 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestFunctionDefaultParameters(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input            string
+		expectedDefaults map[string]string
+		expectedString   string
+	}{
+		{"funk(a, b = 2) {};", map[string]string{"b": "2"}, "funk(a,b = 2)"},
+		{"funk(a = 1, b = a * 2) {};", map[string]string{"a": "1", "b": "(a * 2)"}, "funk(a = 1,b = (a * 2))"},
+		{"funk(a, b) {};", map[string]string{}, "funk(a,b)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := New(l)
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+
+			stmt := program.Statements[0].(*ast.ExpressionStatement)
+			function := stmt.Expression.(*ast.FunctionLiteral)
+
+			if len(function.Defaults) != len(tt.expectedDefaults) {
+				t.Fatalf("wrong number of defaults. want=%d, got=%d",
+					len(tt.expectedDefaults), len(function.Defaults))
+			}
+			for name, expected := range tt.expectedDefaults {
+				def, ok := function.Defaults[name]
+				if !ok {
+					t.Fatalf("no default for %s", name)
+				}
+				if def.String() != expected {
+					t.Errorf("default for %s wrong. want=%q, got=%q", name, expected, def.String())
+				}
+			}
+
+			if function.String() != tt.expectedString {
+				t.Errorf("function.String() wrong. want=%q, got=%q", tt.expectedString, function.String())
+			}
+		})
+	}
+}
+
+func TestFunctionRestParameter(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input          string
+		expectedParams []string
+		expectedRest   string
+	}{
+		{input: "funk(...rest) {};", expectedParams: []string{}, expectedRest: "rest"},
+		{input: "funk(x, ...rest) {};", expectedParams: []string{"x"}, expectedRest: "rest"},
+		{input: "funk(x, y = 1, ...rest) {};", expectedParams: []string{"x", "y"}, expectedRest: "rest"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := New(l)
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+
+			stmt := program.Statements[0].(*ast.ExpressionStatement)
+			function := stmt.Expression.(*ast.FunctionLiteral)
+
+			if len(function.Parameters) != len(tt.expectedParams) {
+				t.Fatalf("length parameters wrong. want %d, got=%d\n",
+					len(tt.expectedParams), len(function.Parameters))
+			}
+			for i, ident := range tt.expectedParams {
+				testLiteralExpression(t, function.Parameters[i], ident)
+			}
+
+			if function.Rest == nil {
+				t.Fatalf("function.Rest is nil")
+			}
+			testLiteralExpression(t, function.Rest, tt.expectedRest)
+		})
+	}
+}
+
+func TestSpreadExpressions(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"add(...pair)", "add(...pair)"},
+		{"add(1, ...rest, 2)", "add(1, ...rest, 2)"},
+		{"[0, ...bum(xs)]", "[0, ...bum(xs)]"},
+		{"[...a + b]", "[...(a + b)]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := New(l)
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+
+			if program.String() != tt.expected {
+				t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+			}
+		})
+	}
+}
+
+func TestFunctionLiteralName(t *testing.T) {
+	t.Parallel()
+	input := "ask add = funk(x, y) { x + y; };"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.AskStatement)
+	function, ok := stmt.Value.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Value is not ast.FunctionLiteral. got=%T", stmt.Value)
+	}
+
+	if function.Name != "add" {
+		t.Errorf("function.Name wrong. want=%q, got=%q", "add", function.Name)
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	t.Parallel()
 	input := "add(1, 2 * 3, 4 + 5);"
@@ -710,6 +1214,275 @@ func TestCallExpressionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestMultiLineProgram(t *testing.T) {
+	t.Parallel()
+	input := `
+ask add = funk(x, y) {
+	giving x + y;
+};
+
+ask result = add(
+	1,
+	2
+);
+`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+
+	expected := "ask add = funk(x,y)giving (x + y);;ask result = add(1, 2);"
+	if program.String() != expected {
+		t.Errorf("program.String() wrong. expected=%q, got=%q",
+			expected, program.String())
+	}
+}
+
+func TestCommentsAreKeptAsTrivia(t *testing.T) {
+	t.Parallel()
+	input := `// the answer
+ask x = 42; /* obviously */`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	expected := []string{"// the answer", "/* obviously */"}
+	if len(program.Comments) != len(expected) {
+		t.Fatalf("program.Comments has wrong length. want=%d, got=%d",
+			len(expected), len(program.Comments))
+	}
+	for i, comment := range program.Comments {
+		if comment.Literal != expected[i] {
+			t.Errorf("comment %d wrong. want=%q, got=%q", i, expected[i], comment.Literal)
+		}
+	}
+}
+
+func TestNodeSpans(t *testing.T) {
+	t.Parallel()
+	input := `ask x = 1;
+ask total = add(x, 2) * 3;
+[1, 2][0];
+{"a": 1};`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{program, "1:1-4:9"},
+		{program.Statements[0], "1:1-1:10"},
+		{program.Statements[1], "2:1-2:26"},
+		{program.Statements[1].(*ast.AskStatement).Name, "2:5-2:10"},
+		{program.Statements[1].(*ast.AskStatement).Value, "2:13-2:26"},
+		{program.Statements[1].(*ast.AskStatement).Value.(*ast.InfixExpression).Left, "2:13-2:22"},
+		{program.Statements[2].(*ast.ExpressionStatement).Expression, "3:1-3:10"},
+		{program.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.IndexExpression).Left, "3:1-3:7"},
+		{program.Statements[3].(*ast.ExpressionStatement).Expression, "4:1-4:9"},
+	}
+
+	for _, tt := range tests {
+		span := tt.node.Span()
+		actual := fmt.Sprintf("%s-%s", span.Start, span.End)
+		if actual != tt.expected {
+			t.Errorf("wrong span for %q. expected=%s, got=%s",
+				tt.node.String(), tt.expected, actual)
+		}
+	}
+}
+
+func TestDiagnosticSpans(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"sniff (1) { (1 + 2) => 3 }", "1:13-1:20"},
+		{"sniff (1) { ((1 + 2)) => 3 }", "1:13-1:22"},
+		{"sniff (1) { {[1]: x} => 1 }", "1:14-1:17"},
+		{"sniff (1) { f(1, 2) => 1 }", "1:13-1:20"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("expected 1 parser error for %q, got %d", tt.input, len(errors))
+		}
+		span := errors[0].Span
+		actual := fmt.Sprintf("%s-%s", span.Start, span.End)
+		if actual != tt.expected {
+			t.Errorf("wrong span for %q. expected=%s, got=%s", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestParserErrorLines(t *testing.T) {
+	t.Parallel()
+	input := `ask x = 5;
+ask y = 10;
+ask = 15;`
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+
+	expected := "3:5: error: expected next token to be IDENT, got ="
+	if errors[0].String() != expected {
+		t.Errorf("wrong error. expected=%q, got=%q", expected, errors[0])
+	}
+	if errors[0].Code != diagnostic.UnexpectedToken {
+		t.Errorf("wrong error code. expected=%q, got=%q",
+			diagnostic.UnexpectedToken, errors[0].Code)
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input              string
+		expectedErrors     []string
+		expectedStatements int
+	}{
+		{
+			"ask x 5;\nask y = 2;\nlog(y);",
+			[]string{"1:7: error: expected next token to be =, got INT"},
+			2,
+		},
+		{
+			"ask x = (1 + 2;\nask y = 2;\nask z = );\nlog(y);",
+			[]string{
+				"1:15: error: expected next token to be ), got ;",
+				"3:9: error: no prefix parse function for ) found",
+			},
+			2,
+		},
+		{
+			"ask x = 1\nlog(x 2) + 3\nask y = x",
+			[]string{"2:7: error: expected next token to be ), got INT"},
+			2,
+		},
+		{
+			"ask f = funk(x) {\n\task = x;\n\tgiving x;\n};\nf(1);",
+			[]string{"2:6: error: expected next token to be IDENT, got ="},
+			2,
+		},
+		{
+			"ask f = funk(x) {\n\tx +\n};\nask y = 1;",
+			[]string{"3:1: error: no prefix parse function for } found"},
+			2,
+		},
+		{
+			"ask f = funk(a = 1, b) {\n\tgiving a;\n};\nask y = 1;",
+			[]string{"1:21: error: parameter b must have a default value since an earlier parameter does"},
+			1,
+		},
+		{
+			"ask f = funk(1) { 1 };\nask y = 1;",
+			[]string{"1:14: error: expected next token to be IDENT, got INT"},
+			1,
+		},
+		{
+			"ask f = funk(...rest, x) { x };\nask y = 1;",
+			[]string{"1:21: error: rest parameter rest must be the last parameter"},
+			1,
+		},
+		{
+			"1 + x = 2;\nask y = 1;",
+			[]string{"1:7: error: cannot assign to (1 + x)"},
+			1,
+		},
+		{
+			"f(x) = 2;\nask y = 1;",
+			[]string{"1:6: error: cannot assign to f(x)"},
+			1,
+		},
+		{
+			"enough;\nask y = 1;",
+			[]string{"1:1: error: enough used outside of a loop"},
+			1,
+		},
+		{
+			"whilst (fact) {\n\tfunk() { anyway; };\n}\nask y = 1;",
+			[]string{"2:11: error: anyway used outside of a loop"},
+			2,
+		},
+		{
+			"peruse (x, y, z in xs) { x }\nask y = 1;",
+			[]string{"1:13: error: expected next token to be IN, got ,"},
+			1,
+		},
+		{
+			"sniff (x) { a + 1 => a }\nask y = 1;",
+			[]string{"1:13: error: cannot match against (a + 1)"},
+			1,
+		},
+		{
+			"sniff (x) { [...rest, last] => last }\nask y = 1;",
+			[]string{"1:14: error: a rest pattern must be a name at the end of the array"},
+			1,
+		},
+		{
+			"sniff (x) { 1 => 2 3 => 4 }\nask y = 1;",
+			[]string{"1:20: error: expected next token to be ,, got INT"},
+			1,
+		},
+		{
+			"attempt { 1 }\nask y = 1;",
+			[]string{"2:1: error: expected next token to be FETCH, got ASK"},
+			1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := New(l)
+			program := p.ParseProgram()
+
+			errors := p.Errors()
+			if len(errors) != len(tt.expectedErrors) {
+				t.Fatalf("wrong number of errors. want=%d, got=%d (%v)",
+					len(tt.expectedErrors), len(errors), errors)
+			}
+			for i, expected := range tt.expectedErrors {
+				if errors[i].String() != expected {
+					t.Errorf("error %d wrong. want=%q, got=%q", i, expected, errors[i])
+				}
+			}
+
+			if len(program.Statements) != tt.expectedStatements {
+				t.Errorf("wrong number of statements. want=%d, got=%d (%q)",
+					tt.expectedStatements, len(program.Statements), program.String())
+			}
+		})
+	}
+}
+
 func testAskStatement(t *testing.T, s ast.Statement, name string) bool {
 	t.Helper()
 	if s.TokenLiteral() != "ask" {
@@ -774,6 +1547,8 @@ func testLiteralExpression(
 		return testIntegerLiteral(t, exp, int64(v))
 	case int64:
 		return testIntegerLiteral(t, exp, v)
+	case float64:
+		return testFloatLiteral(t, exp, v)
 	case string:
 		if v == "fact" || v == "cap" {
 			return testBooleanLiteral(t, exp, v)
@@ -806,6 +1581,22 @@ func testIntegerLiteral(t *testing.T, il ast.Expression, value int64) bool {
 	return true
 }
 
+func testFloatLiteral(t *testing.T, fl ast.Expression, value float64) bool {
+	t.Helper()
+	float, ok := fl.(*ast.FloatLiteral)
+	if !ok {
+		t.Errorf("fl not *ast.FloatLiteral. got=%T", fl)
+		return false
+	}
+
+	if float.Value != value {
+		t.Errorf("float.Value not %g. got=%g", value, float.Value)
+		return false
+	}
+
+	return true
+}
+
 func testIdentifier(t *testing.T, exp ast.Expression, value string) bool {
 	t.Helper()
 	ident, ok := exp.(*ast.Identifier)
@@ -2,15 +2,21 @@ package repl
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"os/user"
+	"strings"
 
+	"github.com/Linkinlog/MagLang/ast"
+	"github.com/Linkinlog/MagLang/compiler"
+	"github.com/Linkinlog/MagLang/diagnostic"
 	"github.com/Linkinlog/MagLang/evaluator"
 	"github.com/Linkinlog/MagLang/lexer"
 	"github.com/Linkinlog/MagLang/object"
 	"github.com/Linkinlog/MagLang/parser"
+	"github.com/Linkinlog/MagLang/vm"
 )
 
 const name = "MagLang"
@@ -27,38 +33,51 @@ const PUPPEROON = `
 /_/_____/____/_______|
 `
 
-func RunFile(filename string) {
-	file, err := os.Open(filename)
+// RunFile parses the whole file as a single program and evaluates it in one
+// environment, so statements are free to span multiple lines. With compiled
+// set it's run on the vm rather than the evaluator.
+func RunFile(filename string, compiled bool) {
+	source, err := os.ReadFile(filename)
 	if err != nil {
 		fmt.Printf("couldnt open file %s\n", filename)
 		return
 	}
 
-	scanner := bufio.NewScanner(file)
-	env := object.NewEnvironment()
+	l := lexer.New(string(source))
+	p := parser.New(l)
 
-	for {
-		scanned := scanner.Scan()
-		if !scanned {
-			return
-		}
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(os.Stdout, string(source), p.Errors())
+		return
+	}
 
-		line := scanner.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
+	var evaluated object.Object
+	if compiled {
+		evaluated = runCompiled(program)
+	} else {
+		evaluated = evaluator.Eval(program, object.NewEnvironment())
+	}
+	printResult(os.Stdout, program, evaluated)
+}
 
-		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParserErrors(os.Stdout, p.Errors())
-			continue
-		}
+// runCompiled compiles program and runs it on the vm, returning what it
+// evaluated to.
+func runCompiled(program *ast.Program) object.Object {
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
 
-		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
-			fmt.Fprint(os.Stdout, evaluated.Inspect())
-			fmt.Fprint(os.Stdout, "\n")
+	machine := vm.New(comp.Bytecode(), vm.Options{})
+	if err := machine.Run(); err != nil {
+		if errObj, ok := err.(*object.Error); ok {
+			return errObj
 		}
+		return &object.Error{Message: err.Error()}
 	}
+
+	return machine.LastPoppedStackElem()
 }
 
 func Start(in io.Reader, out io.Writer) {
@@ -84,18 +103,38 @@ func Start(in io.Reader, out io.Writer) {
 
 		program := p.ParseProgram()
 		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+			printParserErrors(out, line, p.Errors())
 			continue
 		}
 
 		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
-			fmt.Fprint(out, evaluated.Inspect())
-			fmt.Fprint(out, "\n")
-		}
+		printResult(out, program, evaluated)
 	}
 }
 
+// printResult prints what a program evaluated to, with the traceback if it
+// failed. Programs that end without a value print nothing.
+func printResult(out io.Writer, program *ast.Program, evaluated object.Object) {
+	if err, ok := evaluated.(*object.Error); ok {
+		fmt.Fprint(out, err.Traceback())
+		fmt.Fprint(out, "\n")
+	} else if hasValue(program) {
+		fmt.Fprint(out, evaluated.Inspect())
+		fmt.Fprint(out, "\n")
+	}
+}
+
+// hasValue reports whether program ends in something with a value of its
+// own. Both backends hand back null for an ask or an empty program, which
+// isn't worth echoing.
+func hasValue(program *ast.Program) bool {
+	if len(program.Statements) == 0 {
+		return false
+	}
+	_, isAsk := program.Statements[len(program.Statements)-1].(*ast.AskStatement)
+	return !isAsk
+}
+
 func greet() {
 	user, err := user.Current()
 	if err != nil {
@@ -106,11 +145,15 @@ func greet() {
 	fmt.Printf("Please enter some commands!\n")
 }
 
-func printParserErrors(out io.Writer, errors []string) {
-	for _, msg := range errors {
-		fmt.Fprint(out, PUPPEROON)
-		fmt.Fprint(out, "\tWoof! We ran into a problem here!\n")
-		fmt.Fprint(out, "\t parser errors:\n")
-		fmt.Fprint(out, "\t"+msg+"\n")
+func printParserErrors(out io.Writer, source string, errors []diagnostic.Diagnostic) {
+	fmt.Fprint(out, PUPPEROON)
+	fmt.Fprint(out, "\tWoof! We ran into a problem here!\n")
+	fmt.Fprint(out, "\t parser errors:\n")
+	for _, d := range errors {
+		var rendered bytes.Buffer
+		diagnostic.Render(&rendered, source, d)
+		for _, line := range strings.Split(strings.TrimRight(rendered.String(), "\n"), "\n") {
+			fmt.Fprint(out, "\t"+line+"\n")
+		}
 	}
 }
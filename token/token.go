@@ -1,5 +1,7 @@
 package token
 
+import "fmt"
+
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
@@ -8,21 +10,37 @@ const (
 	IDENT = "IDENT"
 	// INT literals 12345
 	INT = "INT"
+	// FLOAT literals 1.5, 1e3, 2.5E-3
+	FLOAT = "FLOAT"
 	// STRING "wow!"
 	STRING = "STRING"
+	// COMMENT // line comments and /* block comments */
+	COMMENT = "COMMENT"
 
 	// Operators
 
-	ASSIGN   = "="
-	PLUS     = "+"
-	MINUS    = "-"
-	BANG     = "!"
-	ASTERISK = "*"
-	SLASH    = "/"
-	LT       = "<"
-	GT       = ">"
-	EQ       = "=="
-	NOT_EQ   = "!="
+	ASSIGN          = "="
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+	PERCENT_ASSIGN  = "%="
+	PLUS            = "+"
+	MINUS           = "-"
+	BANG            = "!"
+	ASTERISK        = "*"
+	SLASH           = "/"
+	PERCENT         = "%"
+	LT              = "<"
+	GT              = ">"
+	EQ              = "=="
+	NOT_EQ          = "!="
+	LT_EQ           = "<="
+	GT_EQ           = ">="
+	AND             = "&&"
+	OR              = "||"
+	ELLIPSIS        = "..."
+	ARROW           = "=>"
 
 	COMMA     = ","
 	SEMICOLON = ";"
@@ -43,6 +61,15 @@ const (
 	IF       = "CONSIDER"
 	ELSE     = "HOWEVER"
 	RETURN   = "GIVING"
+	WHILE    = "WHILST"
+	BREAK    = "ENOUGH"
+	CONTINUE = "ANYWAY"
+	FOR      = "PERUSE"
+	IN       = "IN"
+	MATCH    = "SNIFF"
+	TRY      = "ATTEMPT"
+	CATCH    = "FETCH"
+	THROW    = "YEET"
 )
 
 type TokenType string
@@ -50,9 +77,43 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	Span    Span
+}
+
+// Position is a spot in the source. Line and Column start at 1, Offset is
+// the 0-based byte offset into the input.
+type Position struct {
+	Line   int
+	Column int
+	Offset int
+}
+
+func (p Position) IsValid() bool { return p.Line > 0 }
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Span covers the source from Start up to, but not including, End.
+type Span struct {
+	Start Position
+	End   Position
 }
 
-var TokenTypes = map[byte]TokenType{
+func (s Span) IsValid() bool  { return s.Start.IsValid() }
+func (s Span) String() string { return s.Start.String() }
+
+// To returns a span running from the start of s to the end of other.
+func (s Span) To(other Span) Span {
+	if !other.IsValid() {
+		return s
+	}
+	if !s.IsValid() {
+		return other
+	}
+	return Span{Start: s.Start, End: other.End}
+}
+
+var TokenTypes = map[rune]TokenType{
 	'=': ASSIGN,
 	';': SEMICOLON,
 	':': COLON,
@@ -68,11 +129,27 @@ var TokenTypes = map[byte]TokenType{
 	'!': BANG,
 	'*': ASTERISK,
 	'/': SLASH,
+	'%': PERCENT,
 	'<': LT,
 	'>': GT,
 	0:   EOF,
 }
 
+var TwoCharTokenTypes = map[string]TokenType{
+	"==": EQ,
+	"!=": NOT_EQ,
+	"<=": LT_EQ,
+	">=": GT_EQ,
+	"&&": AND,
+	"||": OR,
+	"+=": PLUS_ASSIGN,
+	"-=": MINUS_ASSIGN,
+	"*=": ASTERISK_ASSIGN,
+	"/=": SLASH_ASSIGN,
+	"%=": PERCENT_ASSIGN,
+	"=>": ARROW,
+}
+
 var keywords = map[string]TokenType{
 	"funk":     FUNCTION,
 	"ask":      LET,
@@ -81,6 +158,15 @@ var keywords = map[string]TokenType{
 	"consider": IF,
 	"however":  ELSE,
 	"giving":   RETURN,
+	"whilst":   WHILE,
+	"enough":   BREAK,
+	"anyway":   CONTINUE,
+	"peruse":   FOR,
+	"in":       IN,
+	"sniff":    MATCH,
+	"attempt":  TRY,
+	"fetch":    CATCH,
+	"yeet":     THROW,
 }
 
 func LookupIdent(ident string) TokenType {
@@ -0,0 +1,44 @@
+package vm
+
+import (
+	"github.com/Linkinlog/MagLang/code"
+	"github.com/Linkinlog/MagLang/object"
+	"github.com/Linkinlog/MagLang/token"
+)
+
+// Frame is a call to a closure in progress.
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+	// numArgs is how many of the parameters the caller passed.
+	numArgs int
+	// chain is set once the frame has been reused for a tail call.
+	chain *tailChain
+}
+
+// tailChain is what a frame remembers of the tail calls it's been reused
+// for, see VM.tailCall.
+type tailChain struct {
+	head     string     // the funk whose call started the chain
+	callSite token.Span // where the latest tail call was made
+	calls    int        // how many tail calls came before the latest
+}
+
+func NewFrame(cl *object.Closure, basePointer, numArgs int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer, numArgs: numArgs}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
+
+// span is the source of the instruction the frame is on.
+func (f *Frame) span() token.Span {
+	return f.cl.Fn.Positions.SpanAt(f.ip)
+}
+
+// name is what to call the frame's funk in messages.
+func (f *Frame) name() string {
+	return functionName(f.cl.Fn)
+}
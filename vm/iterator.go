@@ -0,0 +1,24 @@
+package vm
+
+import (
+	"github.com/Linkinlog/MagLang/evaluator"
+	"github.com/Linkinlog/MagLang/object"
+)
+
+// iterator is what OpIter leaves on the stack for a peruse loop to pull
+// keys and values from. Programs never get their hands on one.
+type iterator struct {
+	next func() (key, value object.Object, ok bool)
+}
+
+func (it *iterator) Type() object.ObjectType { return "ITERATOR" }
+func (it *iterator) Inspect() string         { return "iterator" }
+
+// newIterator walks iterable the same way the evaluator's peruse does.
+func newIterator(iterable object.Object, keyed bool) (*iterator, bool) {
+	next, ok := evaluator.Iterate(iterable, keyed)
+	if !ok {
+		return nil, false
+	}
+	return &iterator{next: next}, true
+}
@@ -0,0 +1,839 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Linkinlog/MagLang/code"
+	"github.com/Linkinlog/MagLang/compiler"
+	"github.com/Linkinlog/MagLang/evaluator"
+	"github.com/Linkinlog/MagLang/object"
+)
+
+const (
+	// StackSize is how many values the stack has room for to start with.
+	// It grows as calls nest, up to MaxStackSize.
+	StackSize    = 1 << 16
+	MaxStackSize = 1 << 24
+	GlobalsSize  = 1 << 16
+)
+
+var (
+	TRUE  = evaluator.TRUE
+	FALSE = evaluator.FALSE
+	NULL  = evaluator.NULL
+)
+
+var infixOperators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpMod:          "%",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpLessThan:     "<",
+	code.OpGreaterThan:  ">",
+	code.OpLessEqual:    "<=",
+	code.OpGreaterEqual: ">=",
+}
+
+// Options tweaks how programs are run. The zero value gives the default
+// behaviour.
+type Options struct {
+	// CheckedArithmetic is evaluator.Options.CheckedArithmetic, for
+	// compiled programs.
+	CheckedArithmetic bool
+	// MaxCallDepth is evaluator.Options.MaxCallDepth, for compiled
+	// programs. Tail calls reuse their caller's frame, so like on the
+	// evaluator they don't count, and only RunContext stops endless tail
+	// recursion. Zero means evaluator.DefaultMaxCallDepth.
+	MaxCallDepth int
+}
+
+// VM runs compiled programs. Operators, builtins and the errors they give
+// are shared with the evaluator, so a program does the same thing however
+// it's run. The evaluator's Limits are the one thing it doesn't support.
+type VM struct {
+	ops  *evaluator.Evaluator
+	opts Options
+	// ctx is checked on every call and every jump back, see RunContext.
+	ctx context.Context
+
+	constants   []object.Object
+	globals     []object.Object
+	globalNames []string
+
+	stack []object.Object
+	sp    int // Always points to the next value. Top of stack is stack[sp-1]
+
+	frames      []*Frame
+	framesIndex int
+
+	handlers []handler
+}
+
+// handler is an attempt whose body is running, and where to unwind to if
+// it fails.
+type handler struct {
+	ip          int
+	sp          int
+	framesIndex int
+}
+
+// cell holds a local that closures capture, see code.OpGetCell. A nil
+// value means the local hasn't been given one yet.
+type cell struct {
+	value object.Object
+}
+
+func (c *cell) Type() object.ObjectType { return "CELL" }
+func (c *cell) Inspect() string         { return "cell" }
+
+func New(bytecode *compiler.Bytecode, opts Options) *VM {
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		Positions:    bytecode.Positions,
+		NumLocals:    bytecode.NumLocals,
+		LocalNames:   bytecode.LocalNames,
+		Name:         "main",
+	}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0, 0)
+
+	if opts.MaxCallDepth == 0 {
+		opts.MaxCallDepth = evaluator.DefaultMaxCallDepth
+	}
+
+	return &VM{
+		ops:  evaluator.New(evaluator.Options{CheckedArithmetic: opts.CheckedArithmetic}),
+		opts: opts,
+		ctx:  context.Background(),
+
+		constants:   bytecode.Constants,
+		globals:     make([]object.Object, GlobalsSize),
+		globalNames: bytecode.GlobalNames,
+
+		stack: make([]object.Object, StackSize),
+		sp:    mainFn.NumLocals,
+
+		frames:      []*Frame{mainFrame},
+		framesIndex: 1,
+	}
+}
+
+// LastPoppedStackElem is what the program evaluated to once Run is done,
+// which is null for a program with no statements.
+func (vm *VM) LastPoppedStackElem() object.Object {
+	if vm.stack[vm.sp] == nil {
+		return NULL
+	}
+	return vm.stack[vm.sp]
+}
+
+// Run executes the program. If it fails, the error is returned as an
+// *object.Error with its span and call stack filled in.
+func (vm *VM) Run() error {
+	return vm.RunContext(context.Background())
+}
+
+// RunContext is like Run, but gives up with an error once ctx is done, the
+// same one evaluator.EvalContext gives. The context is checked on every
+// funk call and every jump back to the top of a loop. Scripts can't catch
+// the error with attempt.
+func (vm *VM) RunContext(ctx context.Context) error {
+	vm.ctx = ctx
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		var err *object.Error
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint32(ins[ip+1:])
+			vm.currentFrame().ip += 4
+			err = vm.push(vm.constants[constIndex])
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpDup:
+			err = vm.push(vm.stack[vm.sp-1])
+
+		case code.OpSwap:
+			vm.stack[vm.sp-1], vm.stack[vm.sp-2] = vm.stack[vm.sp-2], vm.stack[vm.sp-1]
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpEqual, code.OpNotEqual, code.OpLessThan, code.OpGreaterThan,
+			code.OpLessEqual, code.OpGreaterEqual:
+			right := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(vm.ops.Infix(infixOperators[op], left, right))
+
+		case code.OpMinus:
+			err = vm.pushResult(evaluator.Prefix("-", vm.pop()))
+
+		case code.OpBang:
+			err = vm.pushResult(evaluator.Prefix("!", vm.pop()))
+
+		case code.OpTrue:
+			err = vm.push(TRUE)
+
+		case code.OpFalse:
+			err = vm.push(FALSE)
+
+		case code.OpNull:
+			err = vm.push(NULL)
+
+		case code.OpJump:
+			pos := int(code.ReadUint32(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1
+
+			if pos <= ip {
+				err = evaluator.Cancelled(vm.ctx)
+			}
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint32(ins[ip+1:]))
+			vm.currentFrame().ip += 4
+
+			if !evaluator.IsTruthy(vm.pop()) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpJumpIfArg:
+			param := int(code.ReadUint8(ins[ip+1:]))
+			pos := int(code.ReadUint32(ins[ip+2:]))
+			vm.currentFrame().ip += 5
+
+			if param < vm.currentFrame().numArgs {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			value := vm.globals[globalIndex]
+			if value == nil {
+				err = newError("identifier not found: %s", vm.globalNames[globalIndex])
+				break
+			}
+			err = vm.push(value)
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			value := vm.stack[frame.basePointer+int(localIndex)]
+			if value == nil {
+				err = newError("identifier not found: %s", frame.cl.Fn.LocalNames[localIndex])
+				break
+			}
+			err = vm.push(value)
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err = vm.push(object.Builtins[builtinIndex].Builtin)
+
+		case code.OpGetCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			c, ok := vm.stack[frame.basePointer+int(localIndex)].(*cell)
+			if !ok || c.value == nil {
+				err = newError("identifier not found: %s", frame.cl.Fn.LocalNames[localIndex])
+				break
+			}
+			err = vm.push(c.value)
+
+		case code.OpSetCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			vm.localCell(int(localIndex)).value = vm.pop()
+
+		case code.OpFreshCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			vm.stack[vm.currentFrame().basePointer+int(localIndex)] = &cell{}
+
+		case code.OpLoadCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err = vm.push(vm.localCell(int(localIndex)))
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			cl := vm.currentFrame().cl
+			c := cl.Free[freeIndex].(*cell)
+			if c.value == nil {
+				err = newError("identifier not found: %s", cl.Fn.FreeNames[freeIndex])
+				break
+			}
+			err = vm.push(c.value)
+
+		case code.OpSetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			vm.currentFrame().cl.Free[freeIndex].(*cell).value = vm.pop()
+
+		case code.OpLoadFreeCell:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err = vm.push(vm.currentFrame().cl.Free[freeIndex])
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+			err = vm.push(array)
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			hash, hashErr := vm.buildHash(vm.sp-numElements, vm.sp)
+			if hashErr != nil {
+				err = hashErr
+				break
+			}
+			vm.sp = vm.sp - numElements
+
+			err = vm.push(hash)
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(evaluator.Index(left, index))
+
+		case code.OpSetIndex:
+			val := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(vm.ops.AssignIndex("=", left, index, val))
+
+		case code.OpSetIndexOp:
+			operator := code.Opcode(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip += 1
+
+			val := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(vm.ops.AssignIndex(infixOperators[operator]+"=", left, index, val))
+
+		case code.OpSpread:
+			if value := vm.stack[vm.sp-1]; value.Type() != object.ARRAY_OBJ {
+				err = newError("cannot spread %s, only ARRAY", value.Type())
+			}
+
+		case code.OpConcat:
+			numArrays := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			elements := []object.Object{}
+			for _, array := range vm.stack[vm.sp-numArrays : vm.sp] {
+				elements = append(elements, array.(*object.Array).Elements...)
+			}
+			vm.sp = vm.sp - numArrays
+
+			err = vm.push(&object.Array{Elements: elements})
+
+		case code.OpClosure:
+			constIndex := code.ReadUint32(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+5:])
+			vm.currentFrame().ip += 5
+
+			err = vm.pushClosure(int(constIndex), int(numFree))
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err = vm.executeCall(int(numArgs))
+
+		case code.OpCallSpread:
+			args := vm.pop().(*object.Array).Elements
+			for _, arg := range args {
+				if err = vm.push(arg); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				err = vm.executeCall(len(args))
+			}
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			if vm.framesIndex == 1 {
+				// giving at the top level ends the program, and the value
+				// we just popped is what it evaluates to.
+				return nil
+			}
+
+			frame := vm.popFrame()
+			for len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].framesIndex > vm.framesIndex {
+				vm.handlers = vm.handlers[:len(vm.handlers)-1]
+			}
+			vm.sp = frame.basePointer - 1
+
+			err = vm.push(returnValue)
+
+		case code.OpIter:
+			keyed := code.ReadUint8(ins[ip+1:]) == 1
+			vm.currentFrame().ip += 1
+
+			iterable := vm.pop()
+			it, ok := newIterator(iterable, keyed)
+			if !ok {
+				err = newError("cannot peruse %s", iterable.Type())
+				break
+			}
+			err = vm.push(it)
+
+		case code.OpIterNext:
+			pos := int(code.ReadUint32(ins[ip+1:]))
+			vm.currentFrame().ip += 4
+
+			key, value, ok := vm.stack[vm.sp-1].(*iterator).next()
+			if !ok {
+				vm.currentFrame().ip = pos - 1
+				break
+			}
+			if err = vm.push(key); err == nil {
+				err = vm.push(value)
+			}
+
+		case code.OpMarkStack:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)] = &object.Integer{Value: int64(vm.sp)}
+
+		case code.OpUnwindStack:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			vm.sp = int(vm.stack[frame.basePointer+int(localIndex)].(*object.Integer).Value)
+
+		case code.OpMatchArray:
+			length := int(code.ReadUint16(ins[ip+1:]))
+			hasRest := code.ReadUint8(ins[ip+3:]) == 1
+			vm.currentFrame().ip += 3
+
+			array, ok := vm.pop().(*object.Array)
+			matched := ok && (len(array.Elements) == length || hasRest && len(array.Elements) > length)
+			err = vm.push(nativeBoolToBooleanObject(matched))
+
+		case code.OpMatchHash:
+			_, ok := vm.pop().(*object.Hash)
+			err = vm.push(nativeBoolToBooleanObject(ok))
+
+		case code.OpHasKey:
+			key := vm.pop()
+			hash := vm.pop().(*object.Hash)
+			_, ok := hash.Pairs[key.(object.Hashable).HashKey()]
+			err = vm.push(nativeBoolToBooleanObject(ok))
+
+		case code.OpRest:
+			from := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			array := vm.pop().(*object.Array)
+			remaining := make([]object.Object, len(array.Elements)-from)
+			copy(remaining, array.Elements[from:])
+			err = vm.push(&object.Array{Elements: remaining})
+
+		case code.OpMatchEqual:
+			literal := vm.pop()
+			value := vm.pop()
+			err = vm.push(nativeBoolToBooleanObject(evaluator.PatternEquals(literal, value)))
+
+		case code.OpNoMatch:
+			err = newError("no sniff arm matched %s", vm.pop().Inspect())
+
+		case code.OpTry:
+			pos := int(code.ReadUint32(ins[ip+1:]))
+			vm.currentFrame().ip += 4
+
+			vm.handlers = append(vm.handlers, handler{ip: pos, sp: vm.sp, framesIndex: vm.framesIndex})
+
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+		case code.OpThrow:
+			err = evaluator.ThrownError(vm.pop())
+
+		case code.OpRaise:
+			constIndex := code.ReadUint32(ins[ip+1:])
+			vm.currentFrame().ip += 4
+
+			err = newError("%s", vm.constants[constIndex].(*object.String).Value)
+		}
+
+		if err != nil && !vm.recover(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recover fills in where err happened and unwinds to the innermost
+// attempt, handing it the error. It reports false if there's no attempt
+// to catch it.
+func (vm *VM) recover(err *object.Error) bool {
+	if !err.Span.IsValid() {
+		err.Span = vm.currentFrame().span()
+		err.Stack = vm.traceback()
+	}
+
+	// Errors with a Cause aren't the script's doing, so they're not its to
+	// catch either.
+	if len(vm.handlers) == 0 || err.Cause != nil {
+		return false
+	}
+
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+	vm.framesIndex = h.framesIndex
+	vm.sp = h.sp
+	vm.currentFrame().ip = h.ip - 1
+
+	return vm.push(evaluator.ErrorToHash(err)) == nil
+}
+
+// traceback lists the funk calls in progress, innermost first. A frame
+// that's been reused for tail calls shows up as the evaluator has it: the
+// latest call, then the one that started the chain.
+func (vm *VM) traceback() []object.Frame {
+	var frames []object.Frame
+	for i := vm.framesIndex - 1; i > 0; i-- {
+		frame := vm.frames[i]
+		if frame.chain == nil {
+			frames = append(frames, object.Frame{Function: frame.name(), CallSite: vm.frames[i-1].span()})
+			continue
+		}
+		frames = append(frames,
+			object.Frame{Function: frame.name(), CallSite: frame.chain.callSite, TailCalls: frame.chain.calls},
+			object.Frame{Function: frame.chain.head, CallSite: vm.frames[i-1].span()},
+		)
+	}
+	return frames
+}
+
+// reserve makes sure the stack has room for size values, growing it if it
+// has to.
+func (vm *VM) reserve(size int) *object.Error {
+	if size <= len(vm.stack) {
+		return nil
+	}
+	if size > MaxStackSize {
+		return newError("stack overflow")
+	}
+
+	stack := make([]object.Object, min(max(2*len(vm.stack), size), MaxStackSize))
+	copy(stack, vm.stack)
+	vm.stack = stack
+	return nil
+}
+
+func (vm *VM) push(o object.Object) *object.Error {
+	if err := vm.reserve(vm.sp + 1); err != nil {
+		return err
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+// pushResult pushes the result of a shared operation, or returns it if
+// it's an error.
+func (vm *VM) pushResult(o object.Object) *object.Error {
+	if err, ok := o.(*object.Error); ok {
+		return err
+	}
+	return vm.push(o)
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	if vm.framesIndex == len(vm.frames) {
+		vm.frames = append(vm.frames, f)
+	} else {
+		vm.frames[vm.framesIndex] = f
+	}
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// localCell returns the cell for a boxed local, creating it if the local
+// hasn't got one yet. A parameter still holding its argument gets a cell
+// with the argument in it.
+func (vm *VM) localCell(localIndex int) *cell {
+	slot := vm.currentFrame().basePointer + localIndex
+	if c, ok := vm.stack[slot].(*cell); ok {
+		return c
+	}
+
+	c := &cell{value: vm.stack[slot]}
+	vm.stack[slot] = c
+	return c
+}
+
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+	copy(elements, vm.stack[startIndex:endIndex])
+
+	return &object.Array{Elements: elements}
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, *object.Error) {
+	hashedPairs := make(map[object.HashKey]object.HashPair)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, newError("unusable as hash key: %s", key.Type())
+		}
+
+		hashedPairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: hashedPairs}, nil
+}
+
+func (vm *VM) pushClosure(constIndex, numFree int) *object.Error {
+	function, ok := vm.constants[constIndex].(*object.CompiledFunction)
+	if !ok {
+		return newError("not a function: %s", vm.constants[constIndex].Type())
+	}
+
+	free := make([]object.Object, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp = vm.sp - numFree
+
+	return vm.push(&object.Closure{Fn: function, Free: free})
+}
+
+func (vm *VM) executeCall(numArgs int) *object.Error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		if vm.inTailPosition() {
+			return vm.tailCall(callee, numArgs)
+		}
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return newError("not a function: %s", callee.Type())
+	}
+}
+
+// callClosure sets up a frame for cl with the arguments as its first
+// locals. Arguments past the parameters go into the rest array, and
+// parameters without an argument are left for their defaults to fill in.
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) *object.Error {
+	fn := cl.Fn
+
+	// The main frame doesn't count towards the depth.
+	if vm.framesIndex > vm.opts.MaxCallDepth {
+		return newError("maximum recursion depth exceeded in `%s`", functionName(fn))
+	}
+	if err := vm.checkCall(fn, numArgs); err != nil {
+		return err
+	}
+
+	var rest *object.Array
+	if fn.Rest {
+		rest = &object.Array{Elements: []object.Object{}}
+		if extra := numArgs - fn.NumParameters; extra > 0 {
+			rest.Elements = append(rest.Elements, vm.stack[vm.sp-extra:vm.sp]...)
+			vm.sp -= extra
+			numArgs = fn.NumParameters
+		}
+	}
+
+	basePointer := vm.sp - numArgs
+	if err := vm.reserve(basePointer + fn.NumLocals + 1); err != nil {
+		return err
+	}
+
+	// Slots left over from earlier calls would look like values that are
+	// already set.
+	clear(vm.stack[basePointer+numArgs : basePointer+fn.NumLocals])
+	if rest != nil {
+		vm.stack[basePointer+fn.NumParameters] = rest
+	}
+
+	vm.pushFrame(NewFrame(cl, basePointer, numArgs))
+	vm.sp = basePointer + fn.NumLocals
+
+	return nil
+}
+
+// checkCall returns an error if fn can't be called with numArgs
+// arguments, which is the caller's fault, or if the run has been called
+// off.
+func (vm *VM) checkCall(fn *object.CompiledFunction, numArgs int) *object.Error {
+	required := fn.NumParameters - fn.NumDefaults
+	if numArgs < required || numArgs > fn.NumParameters && !fn.Rest {
+		return arityError(fn, numArgs)
+	}
+	return evaluator.Cancelled(vm.ctx)
+}
+
+// inTailPosition reports whether the call just read is one the evaluator
+// would make as a tail call: all that's left of its frame is to return what
+// it gives back. Calls from the main frame never are, and nor are calls
+// inside one of the frame's attempts, since the attempt has to be around to
+// catch what they fail with.
+func (vm *VM) inTailPosition() bool {
+	if vm.framesIndex == 1 {
+		return false
+	}
+	if n := len(vm.handlers); n > 0 && vm.handlers[n-1].framesIndex == vm.framesIndex {
+		return false
+	}
+
+	ins := vm.currentFrame().Instructions()
+	ip := vm.currentFrame().ip + 1
+	for ip < len(ins) && code.Opcode(ins[ip]) == code.OpJump {
+		ip = int(code.ReadUint32(ins[ip+1:]))
+	}
+	return ip < len(ins) && code.Opcode(ins[ip]) == code.OpReturnValue
+}
+
+// tailCall calls cl in place of the current frame, since its call is over
+// once cl's is. This keeps tail recursion from running out of frames, and
+// the frame remembers the chain of calls it's been reused for, so
+// tracebacks still show them.
+func (vm *VM) tailCall(cl *object.Closure, numArgs int) *object.Error {
+	if err := vm.checkCall(cl.Fn, numArgs); err != nil {
+		return err
+	}
+
+	frame := vm.popFrame()
+	chain := &tailChain{head: frame.name(), callSite: frame.span()}
+	if frame.chain != nil {
+		chain.head = frame.chain.head
+		chain.calls = frame.chain.calls + 1
+	}
+
+	// Slide the funk and its arguments down over the frame's own.
+	callee := vm.sp - 1 - numArgs
+	copy(vm.stack[frame.basePointer-1:], vm.stack[callee:vm.sp])
+	vm.sp = frame.basePointer + numArgs
+
+	if err := vm.callClosure(cl, numArgs); err != nil {
+		return err
+	}
+	vm.currentFrame().chain = chain
+	return nil
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) *object.Error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	result := builtin.Fn(args...)
+	if err, ok := result.(*object.Error); ok {
+		return err
+	}
+	vm.sp = vm.sp - numArgs - 1
+
+	if result != nil {
+		return vm.push(result)
+	}
+	return vm.push(NULL)
+}
+
+// functionName is what to call fn in messages, falling back to "funk" for
+// funks that were never bound to a name.
+func functionName(fn *object.CompiledFunction) string {
+	if fn.Name == "" {
+		return "funk"
+	}
+	return fn.Name
+}
+
+func arityError(fn *object.CompiledFunction, got int) *object.Error {
+	name := functionName(fn)
+
+	want := fmt.Sprint(fn.NumParameters)
+	switch {
+	case fn.Rest:
+		want = fmt.Sprintf("%d or more", fn.NumParameters-fn.NumDefaults)
+	case fn.NumDefaults > 0:
+		want = fmt.Sprintf("%d..%d", fn.NumParameters-fn.NumDefaults, fn.NumParameters)
+	}
+
+	return newError("wrong number of arguments to `%s`. got=%d, want=%s", name, got, want)
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
+func newError(format string, a ...any) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
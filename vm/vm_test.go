@@ -0,0 +1,177 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Linkinlog/MagLang/compiler"
+	"github.com/Linkinlog/MagLang/lexer"
+	"github.com/Linkinlog/MagLang/object"
+	"github.com/Linkinlog/MagLang/parser"
+)
+
+// The language itself is tested in the evaluator package, where every case
+// runs on both backends. These cover what only the vm has.
+
+// testRun compiles and runs input, returning what it evaluated to or the
+// error it failed with.
+func testRun(input string) object.Object {
+	return testRunWith(input, Options{})
+}
+
+func testRunWith(input string, opts Options) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		panic(fmt.Sprintf("compiler error: %s", err))
+	}
+
+	vm := New(comp.Bytecode(), opts)
+	if err := vm.Run(); err != nil {
+		return err.(*object.Error)
+	}
+
+	return vm.LastPoppedStackElem()
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d",
+			result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func TestFunctionObject(t *testing.T) {
+	t.Parallel()
+	input := `ask add = funk(x, y = 1) { x + y; }; add;`
+
+	evaluated := testRun(input)
+	cl, ok := evaluated.(*object.Closure)
+	if !ok {
+		t.Fatalf("object is not Closure. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if cl.Type() != object.FUNCTION_OBJ {
+		t.Errorf("closure has wrong type. got=%s", cl.Type())
+	}
+	if cl.Fn.Name != "add" || cl.Fn.NumParameters != 2 || cl.Fn.NumDefaults != 1 {
+		t.Errorf("compiled function is wrong. got=%+v", cl.Fn)
+	}
+}
+
+func TestCheckedArithmetic(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"9223372036854775807 + 1", "integer overflow: 9223372036854775807 + 1"},
+		{"-9223372036854775807 - 2", "integer overflow: -9223372036854775807 - 2"},
+		{"4611686018427387904 * 2", "integer overflow: 4611686018427387904 * 2"},
+		{"-1 * (-9223372036854775807 - 1)", "integer overflow: -1 * -9223372036854775808"},
+		{"9223372036854775806 + 1", 9223372036854775807},
+		{"-9223372036854775807 - 1", -9223372036854775808},
+		{"3037000499 * 3037000499", 9223372030926249001},
+		{"1 - 2", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			checked := testRunWith(tt.input, Options{CheckedArithmetic: true})
+			switch expected := tt.expected.(type) {
+			case int:
+				testIntegerObject(t, checked, int64(expected))
+			case string:
+				errObj, ok := checked.(*object.Error)
+				if !ok {
+					t.Fatalf("no error object returned. got=%T(%+v)", checked, checked)
+				}
+				if errObj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q",
+						expected, errObj.Message)
+				}
+
+				// Without checking we wrap around like Go does.
+				if unchecked := testRun(tt.input); unchecked.Type() == object.ERROR_OBJ {
+					t.Errorf("unchecked evaluation errored: %s", unchecked.Inspect())
+				}
+			}
+		})
+	}
+}
+
+// Errors with a Cause, like a cancelled context, stop the program even
+// inside an attempt.
+func TestRecover(t *testing.T) {
+	t.Parallel()
+	program := parser.New(lexer.New("attempt { 1 } fetch { 2 };")).ParseProgram()
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode(), Options{})
+	vm.handlers = []handler{{ip: 0, sp: vm.sp, framesIndex: 1}}
+	if vm.recover(&object.Error{Message: "stop", Cause: errors.New("stop")}) {
+		t.Errorf("an error with a Cause was caught")
+	}
+	if len(vm.handlers) != 1 {
+		t.Errorf("the attempt was unwound. got=%d handlers", len(vm.handlers))
+	}
+	if !vm.recover(&object.Error{Message: "oops"}) {
+		t.Errorf("an ordinary error wasn't caught")
+	}
+}
+
+func TestLargePrograms(t *testing.T) {
+	t.Parallel()
+	var assignments, block strings.Builder
+	assignments.WriteString("ask x = 0;\n")
+	for i := 0; i < 70000; i++ {
+		fmt.Fprintf(&assignments, "x = %d;\n", i)
+	}
+	assignments.WriteString("x;")
+
+	block.WriteString("ask y = 1; ask r = consider (cap) {\n")
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&block, "y = y + %d;\n", i)
+	}
+	block.WriteString("} however { y + 1 }; r;")
+
+	elements := make([]string, 70000)
+	for i := range elements {
+		elements[i] = fmt.Sprint(i)
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"many constants", assignments.String(), "69999"},
+		{"long jumps", block.String(), "2"},
+		{"long array", "ask a = [" + strings.Join(elements, ", ") + "]; [thickness(a), a[69999]];", "[70000, 69999]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			evaluated := testRun(tt.input)
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("wrong result. want=%s, got=%s", tt.expected, evaluated.Inspect())
+			}
+		})
+	}
+}